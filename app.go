@@ -4,15 +4,37 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	"myproject/functions"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 // App struct
 type App struct {
 	ctx context.Context
+
+	tasksMu sync.Mutex
+	tasks   map[string]runningTask
+	taskID  int
 }
 
+// runningTask is a cancellable long-running operation, such as a scan
+type runningTask struct {
+	id     int
+	cancel context.CancelFunc
+}
+
+const (
+	cleanerScanTask  = "cleaner-scan"
+	diskAnalysisTask = "disk-analysis"
+	duplicateTask    = "duplicate-scan"
+	artifactTask     = "artifact-scan"
+	compressTask     = "compress-scan"
+)
+
 // NewApp creates a new App application struct
 func NewApp() *App {
 	return &App{}
@@ -24,6 +46,7 @@ func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 	functions.StartCPUMonitoring(ctx)
 	functions.StartMemoryMonitoring(ctx)
+	functions.StartCleanScheduler(ctx)
 }
 
 // Greet returns a greeting for the given name
@@ -87,28 +110,369 @@ func (a *App) GetBatteryDetails() (string, error) {
 }
 
 func (a *App) ScanCleanableFiles() (functions.CleanerResult, error) {
-	result := functions.GetCleanableFiles()
+	return a.ScanCleanableFilesWithOptions(functions.ScanOptions{})
+}
+
+// ScanCleanableFilesWithOptions scans for cleanable files; ForceRescan skips the scan cache
+func (a *App) ScanCleanableFilesWithOptions(options functions.ScanOptions) (functions.CleanerResult, error) {
+	ctx, done := a.beginTask(cleanerScanTask)
+	defer done()
+
+	result, err := functions.GetCleanableFilesWithOptions(ctx, options, a.emitScanProgress)
+	if err != nil {
+		return result, fmt.Errorf("cleaner scan stopped: %w", err)
+	}
 	return result, nil
 }
 
 // ScanSafeCleanableFiles scans only user directories (no admin required)
 func (a *App) ScanSafeCleanableFiles() (functions.CleanerResult, error) {
-	result := functions.SafeClean()
+	return a.ScanSafeCleanableFilesWithOptions(functions.ScanOptions{})
+}
+
+// ScanSafeCleanableFilesWithOptions is ScanSafeCleanableFiles; ForceRescan skips the scan cache
+func (a *App) ScanSafeCleanableFilesWithOptions(options functions.ScanOptions) (functions.CleanerResult, error) {
+	ctx, done := a.beginTask(cleanerScanTask)
+	defer done()
+
+	result, err := functions.SafeCleanWithOptions(ctx, options, a.emitScanProgress)
+	if err != nil {
+		return result, fmt.Errorf("cleaner scan stopped: %w", err)
+	}
 	return result, nil
 }
 
+// GetCleanableChildren lists a page of the children of a scanned entry, biggest first
+func (a *App) GetCleanableChildren(parent functions.FileInfo, page functions.EntryPage) (*functions.CleanableChildren, error) {
+	children, err := functions.GetCleanableChildren(parent, page)
+	if err != nil {
+		return nil, fmt.Errorf("error listing cleanable entries: %w", err)
+	}
+	return children, nil
+}
+
+// CancelCleanerScan stops the running cleaner scan, if any
+func (a *App) CancelCleanerScan() {
+	a.cancelTask(cleanerScanTask)
+}
+
+// beginTask cancels any task of the same kind still running and returns a context
+// for a new one. The returned func must be called when the task finishes.
+func (a *App) beginTask(kind string) (context.Context, func()) {
+	a.tasksMu.Lock()
+	defer a.tasksMu.Unlock()
+
+	if a.tasks == nil {
+		a.tasks = map[string]runningTask{}
+	}
+	if task, exists := a.tasks[kind]; exists {
+		task.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.taskID++
+	id := a.taskID
+	a.tasks[kind] = runningTask{id: id, cancel: cancel}
+
+	return ctx, func() {
+		cancel()
+
+		a.tasksMu.Lock()
+		defer a.tasksMu.Unlock()
+		// Only clear if a newer task hasn't replaced us
+		if a.tasks[kind].id == id {
+			delete(a.tasks, kind)
+		}
+	}
+}
+
+func (a *App) cancelTask(kind string) {
+	a.tasksMu.Lock()
+	defer a.tasksMu.Unlock()
+
+	if task, exists := a.tasks[kind]; exists {
+		task.cancel()
+	}
+}
+
+func (a *App) emitScanProgress(progress functions.ScanProgress) {
+	runtime.EventsEmit(a.ctx, "cleaner-scan-progress", progress)
+}
+
 // CleanSelectedFiles cleans the selected files and returns results
-func (a *App) CleanSelectedFiles(files []functions.FileInfo) map[string]interface{} {
-	count, size, failures := functions.CleanFiles(files)
+func (a *App) CleanSelectedFiles(files []functions.FileInfo) functions.CleanReport {
+	return functions.CleanFilesWithOptions(files, functions.CleanOptions{Mode: functions.CleanModeDelete})
+}
+
+// CleanSelectedFilesWithOptions cleans the selected files, optionally moving them into quarantine
+func (a *App) CleanSelectedFilesWithOptions(files []functions.FileInfo, options functions.CleanOptions) functions.CleanReport {
+	return functions.CleanFilesWithOptions(files, options)
+}
+
+// GetCleanJobs returns the saved cleaning jobs and the last result of each
+func (a *App) GetCleanJobs() (map[string]interface{}, error) {
+	jobs, err := functions.LoadCleanJobs()
+	if err != nil {
+		return nil, fmt.Errorf("error loading cleaning jobs: %w", err)
+	}
 
 	return map[string]interface{}{
-		"cleanedCount":  count,
-		"cleanedSize":   size,
-		"formattedSize": functions.GetFormattedSize(size),
+		"jobs":    jobs,
+		"results": functions.GetCleanJobResults(),
+	}, nil
+}
+
+// SaveCleanJob adds or updates a cleaning job
+func (a *App) SaveCleanJob(job functions.CleanJob) (functions.CleanJob, error) {
+	saved, err := functions.SaveCleanJob(job)
+	if err != nil {
+		return saved, fmt.Errorf("error saving cleaning job: %w", err)
+	}
+	return saved, nil
+}
+
+// DeleteCleanJob removes a cleaning job
+func (a *App) DeleteCleanJob(id string) error {
+	if err := functions.DeleteCleanJob(id); err != nil {
+		return fmt.Errorf("error deleting cleaning job: %w", err)
+	}
+	return nil
+}
+
+// RunCleanJobNow runs a cleaning job right away and reports it like a scheduled run
+func (a *App) RunCleanJobNow(id string) (functions.CleanJobRun, error) {
+	run, err := functions.RunCleanJob(a.ctx, id)
+	if err != nil {
+		return run, fmt.Errorf("error running cleaning job: %w", err)
+	}
+	functions.EmitCleanJobRun(a.ctx, run)
+	return run, nil
+}
+
+// GetCleanHistory returns past clean runs from the audit log, newest first, filtered by
+// category, path and date range
+func (a *App) GetCleanHistory(query functions.AuditQuery) ([]functions.AuditRun, error) {
+	runs, err := functions.QueryAuditLog(query)
+	if err != nil {
+		return nil, fmt.Errorf("error reading clean history: %w", err)
+	}
+	return runs, nil
+}
+
+// GetLifetimeReclaimed returns how much space the cleaner has reclaimed over all runs
+func (a *App) GetLifetimeReclaimed() (map[string]interface{}, error) {
+	totals, err := functions.GetAuditTotals()
+	if err != nil {
+		return nil, fmt.Errorf("error reading clean history: %w", err)
+	}
+
+	return map[string]interface{}{
+		"runs":           totals.Runs,
+		"removedItems":   totals.RemovedItems,
+		"reclaimedBytes": totals.ReclaimedBytes,
+		"formattedSize":  functions.GetFormattedSize(totals.ReclaimedBytes),
+	}, nil
+}
+
+// ListQuarantineBatches returns the quarantined clean runs, newest first
+func (a *App) ListQuarantineBatches() ([]functions.QuarantineBatch, error) {
+	return functions.ListQuarantineBatches()
+}
+
+// RestoreQuarantineBatch moves every item of a batch back to its original location
+func (a *App) RestoreQuarantineBatch(batchID string) map[string]interface{} {
+	restored, failures := functions.RestoreQuarantineBatch(batchID)
+
+	return map[string]interface{}{
+		"restoredCount": restored,
 		"failures":      failures,
 	}
 }
 
+// RestoreQuarantineItems moves the chosen items of a batch back to their original locations
+func (a *App) RestoreQuarantineItems(batchID string, itemIDs []string) map[string]interface{} {
+	restored, failures := functions.RestoreQuarantineItems(batchID, itemIDs)
+
+	return map[string]interface{}{
+		"restoredCount": restored,
+		"failures":      failures,
+	}
+}
+
+// PurgeQuarantine permanently deletes quarantine batches older than the given number of days
+func (a *App) PurgeQuarantine(olderThanDays int) (map[string]interface{}, error) {
+	purged, size, err := functions.PurgeQuarantine(time.Duration(olderThanDays) * 24 * time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("error purging quarantine: %w", err)
+	}
+
+	return map[string]interface{}{
+		"purgedBatches": purged,
+		"purgedSize":    size,
+		"formattedSize": functions.GetFormattedSize(size),
+	}, nil
+}
+
+// PlanCleanSelectedFiles returns what CleanSelectedFilesWithOptions would do without deleting anything
+func (a *App) PlanCleanSelectedFiles(files []functions.FileInfo, options functions.CleanOptions) functions.CleanPlan {
+	return functions.PlanCleanFiles(files, options)
+}
+
+// GetCleanerRules returns the active cleaner rules and where user overrides are read from
+func (a *App) GetCleanerRules() (map[string]interface{}, error) {
+	rules, err := functions.LoadCleanerRules()
+	if err != nil {
+		return nil, fmt.Errorf("error loading cleaner rules: %w", err)
+	}
+
+	path, err := functions.CleanerRulesPath()
+	if err != nil {
+		return nil, fmt.Errorf("error locating cleaner rules: %w", err)
+	}
+
+	return map[string]interface{}{
+		"rules":        rules,
+		"overridePath": path,
+	}, nil
+}
+
+// GetProtectionRules returns the built-in protected paths and the user's exclusions and allow-paths
+func (a *App) GetProtectionRules() (map[string]interface{}, error) {
+	rules, err := functions.GetProtectionRules()
+	if err != nil {
+		return nil, fmt.Errorf("error loading protection rules: %w", err)
+	}
+
+	settings, err := functions.LoadProtectionSettings()
+	if err != nil {
+		return nil, fmt.Errorf("error loading protection settings: %w", err)
+	}
+
+	return map[string]interface{}{
+		"rules":    rules,
+		"settings": settings,
+	}, nil
+}
+
+// SaveProtectionSettings stores the user's exclusions and pinned allow-paths
+func (a *App) SaveProtectionSettings(settings functions.ProtectionSettings) error {
+	if err := functions.SaveProtectionSettings(settings); err != nil {
+		return fmt.Errorf("error saving protection settings: %w", err)
+	}
+	return nil
+}
+
+// ExplainProtection returns the rule that keeps path out of scans, or nil when it isn't protected
+func (a *App) ExplainProtection(path string) *functions.ProtectionRule {
+	rule, _ := functions.ExplainProtection(path)
+	return rule
+}
+
+// AnalyzeDiskUsage walks root and returns a size tree depth levels deep plus the
+// largest files and directories. An empty root analyzes the home directory.
+func (a *App) AnalyzeDiskUsage(root string, depth int) (*functions.DiskAnalysis, error) {
+	ctx, done := a.beginTask(diskAnalysisTask)
+	defer done()
+
+	analysis, err := functions.AnalyzeDiskUsage(ctx, root, functions.DiskAnalysisOptions{Depth: depth}, func(progress functions.ScanProgress) {
+		runtime.EventsEmit(a.ctx, "disk-analysis-progress", progress)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error analyzing disk usage: %w", err)
+	}
+	return analysis, nil
+}
+
+// GetDiskUsageNode drills down into a directory of the last disk analysis
+func (a *App) GetDiskUsageNode(path string, depth int) (*functions.DiskUsageNode, error) {
+	return functions.GetDiskUsageNode(path, depth)
+}
+
+// CancelDiskAnalysis stops the running disk analysis, if any
+func (a *App) CancelDiskAnalysis() {
+	a.cancelTask(diskAnalysisTask)
+}
+
+// FindDuplicateFiles looks for files with identical contents below the given roots
+func (a *App) FindDuplicateFiles(roots []string, minSize int64) (*functions.DuplicateReport, error) {
+	ctx, done := a.beginTask(duplicateTask)
+	defer done()
+
+	report, err := functions.FindDuplicates(ctx, roots, functions.DuplicateOptions{MinSize: minSize}, func(progress functions.ScanProgress) {
+		runtime.EventsEmit(a.ctx, "duplicate-scan-progress", progress)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error finding duplicates: %w", err)
+	}
+	return report, nil
+}
+
+// CancelDuplicateScan stops the running duplicate search, if any
+func (a *App) CancelDuplicateScan() {
+	a.cancelTask(duplicateTask)
+}
+
+// FindBuildArtifacts looks for build output directories (node_modules, target, ...)
+// of the projects below the given workspace roots
+func (a *App) FindBuildArtifacts(roots []string, options functions.ArtifactOptions) (*functions.ArtifactReport, error) {
+	ctx, done := a.beginTask(artifactTask)
+	defer done()
+
+	report, err := functions.FindBuildArtifacts(ctx, roots, options, func(progress functions.ScanProgress) {
+		runtime.EventsEmit(a.ctx, "artifact-scan-progress", progress)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error finding build artifacts: %w", err)
+	}
+	return report, nil
+}
+
+// CancelArtifactScan stops the running build artifact search, if any
+func (a *App) CancelArtifactScan() {
+	a.cancelTask(artifactTask)
+}
+
+// FindCompressibleFiles looks for large, old text files below roots and estimates
+// what gzipping each of them would save
+func (a *App) FindCompressibleFiles(roots []string, options functions.CompressOptions) (*functions.CompressReport, error) {
+	ctx, done := a.beginTask(compressTask)
+	defer done()
+
+	report, err := functions.FindCompressibleFiles(ctx, roots, options, func(progress functions.ScanProgress) {
+		runtime.EventsEmit(a.ctx, "compress-scan-progress", progress)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error finding compressible files: %w", err)
+	}
+	return report, nil
+}
+
+// CancelCompressScan stops the running compressible file search, if any
+func (a *App) CancelCompressScan() {
+	a.cancelTask(compressTask)
+}
+
+// CompressSelectedFiles gzips the selected files in place
+func (a *App) CompressSelectedFiles(files []functions.FileInfo) functions.CleanReport {
+	return functions.CleanFilesWithOptions(files, functions.CleanOptions{Mode: functions.CleanModeCompress})
+}
+
+// DeleteDuplicateFiles removes the chosen duplicate copies, keeping at least one of each
+func (a *App) DeleteDuplicateFiles(paths []string, options functions.CleanOptions) functions.CleanReport {
+	return functions.DeleteDuplicates(paths, options)
+}
+
+// HardlinkDuplicateFiles replaces the chosen duplicates with hardlinks to keep
+func (a *App) HardlinkDuplicateFiles(keep string, duplicates []string) functions.CleanReport {
+	return functions.HardlinkDuplicates(keep, duplicates)
+}
+
+// GetDeletedOpenFiles returns the processes holding deleted files open, which keeps
+// their space from being freed
+func (a *App) GetDeletedOpenFiles() functions.DeletedFilesReport {
+	return functions.FindDeletedOpenFiles()
+}
+
 // CheckCleanerPermissions checks if we have elevated permissions
 func (a *App) CheckCleanerPermissions() functions.PermissionStatus {
 	return functions.CheckPermissions()
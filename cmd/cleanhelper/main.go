@@ -0,0 +1,25 @@
+// Command sysinfopro-cleanhelper deletes the files SysInfo Pro finds in system
+// locations, so the app itself never has to run as root. The app starts it through
+// pkexec and talks to it over stdin and stdout; see functions.ServeCleanHelper.
+//
+//	go build -o sysinfopro-cleanhelper ./cmd/cleanhelper
+//
+// Install it as /usr/libexec/sysinfopro-cleanhelper, owned by root with mode 0755,
+// together with build/linux/com.sysinfopro.cleanhelper.policy, whose action covers
+// exactly that path. The app runs the helper from nowhere else, and not at all if the
+// file or a directory above it is writable by anyone but root.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"myproject/functions"
+)
+
+func main() {
+	if err := functions.ServeCleanHelper(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,301 @@
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Electron apps keep a Chromium cache in their data directory. Only these
+// subdirectories are returned; the rest holds logins, settings and local state.
+var electronCacheDirNames = []string{"Cache", "Code Cache", "GPUCache"}
+
+// electronApp names an Electron app's data directory on each OS, relative to the
+// config (Linux), Application Support (macOS) or APPDATA (Windows) dir. Sandboxed
+// installs on Linux are relative to the home directory.
+type electronApp struct {
+	linux     string
+	darwin    string
+	windows   string
+	sandboxed []string
+}
+
+// codeEditor is a VS Code-family editor and where it installs extensions, relative to home
+type codeEditor struct {
+	electronApp
+	extensions string
+}
+
+var (
+	slackApp = electronApp{linux: "Slack", darwin: "Slack", windows: "Slack",
+		sandboxed: []string{"snap/slack/current/.config/Slack", ".var/app/com.slack.Slack/config/Slack"}}
+	discordApp = electronApp{linux: "discord", darwin: "discord", windows: "discord",
+		sandboxed: []string{"snap/discord/current/.config/discord", ".var/app/com.discordapp.Discord/config/discord"}}
+	teamsApp = electronApp{linux: "Microsoft/Microsoft Teams", darwin: "Microsoft/Teams", windows: "Microsoft/Teams"}
+
+	codeEditors = []codeEditor{
+		{electronApp{linux: "Code", darwin: "Code", windows: "Code",
+			sandboxed: []string{".var/app/com.visualstudio.code/config/Code"}}, ".vscode/extensions"},
+		{electronApp{linux: "Code - Insiders", darwin: "Code - Insiders", windows: "Code - Insiders"}, ".vscode-insiders/extensions"},
+		{electronApp{linux: "VSCodium", darwin: "VSCodium", windows: "VSCodium",
+			sandboxed: []string{".var/app/com.vscodium.codium/config/VSCodium"}}, ".vscode-oss/extensions"},
+		{electronApp{linux: "Cursor", darwin: "Cursor", windows: "Cursor"}, ".cursor/extensions"},
+	}
+)
+
+// dataDirs returns the places the app keeps its data on this OS
+func (a electronApp) dataDirs() []string {
+	home := userHomeDir()
+
+	var dirs []string
+	switch runtime.GOOS {
+	case "linux":
+		if config := rulePathVar("XDG_CONFIG_HOME"); config != "" {
+			dirs = append(dirs, filepath.Join(config, filepath.FromSlash(a.linux)))
+		}
+		if home != "" {
+			for _, sandboxed := range a.sandboxed {
+				dirs = append(dirs, filepath.Join(home, filepath.FromSlash(sandboxed)))
+			}
+		}
+	case "darwin":
+		if home != "" {
+			dirs = append(dirs, filepath.Join(home, "Library", "Application Support", filepath.FromSlash(a.darwin)))
+		}
+	case "windows":
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			dirs = append(dirs, filepath.Join(appData, filepath.FromSlash(a.windows)))
+		}
+	}
+	return dirs
+}
+
+// cacheDirs lists the Chromium cache subdirectories of the app
+func (a electronApp) cacheDirs() []string {
+	var dirs []string
+	for _, dataDir := range a.dataDirs() {
+		for _, name := range electronCacheDirNames {
+			dirs = append(dirs, filepath.Join(dataDir, name))
+		}
+	}
+	return dirs
+}
+
+func codeCacheDirs() []string {
+	var dirs []string
+	for _, editor := range codeEditors {
+		dirs = append(dirs, editor.cacheDirs()...)
+	}
+	return dirs
+}
+
+// codeStorageDirs lists the workspaceStorage and globalStorage dirs of every editor
+func codeStorageDirs() []string {
+	var dirs []string
+	for _, editor := range codeEditors {
+		for _, dataDir := range editor.dataDirs() {
+			dirs = append(dirs,
+				filepath.Join(dataDir, "User", "workspaceStorage"),
+				filepath.Join(dataDir, "User", "globalStorage"))
+		}
+	}
+	return dirs
+}
+
+// scanCodeStorage offers the storage of workspaces whose folder is gone and of
+// extensions the editor recorded as uninstalled. Everything else is left alone: it
+// holds editor state, not caches.
+func (s *cleanerScanner) scanCodeStorage(dir DirInfo) ([]FileInfo, int64) {
+	var files []FileInfo
+	var totalSize int64
+
+	entries, err := os.ReadDir(dir.Path)
+	if err != nil {
+		return files, 0
+	}
+	rootInfo, err := os.Stat(dir.Path)
+	if err != nil {
+		return files, 0
+	}
+	device, deviceKnown := deviceOf(rootInfo)
+
+	global := filepath.Base(dir.Path) == "globalStorage"
+	var uninstalled map[string]bool
+	if global {
+		if uninstalled = uninstalledExtensions(dir.Path); len(uninstalled) == 0 {
+			return files, 0
+		}
+	}
+
+	for _, entry := range entries {
+		if s.ctx.Err() != nil {
+			break
+		}
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir.Path, entry.Name())
+
+		var name, source string
+		if global {
+			if !uninstalled[strings.ToLower(entry.Name())] {
+				continue
+			}
+			name = entry.Name() + " (uninstalled)"
+		} else {
+			folder, orphaned := orphanedWorkspace(path)
+			if !orphaned {
+				continue
+			}
+			name, source = filepath.Base(folder)+" (orphaned)", folder
+		}
+
+		if isProtectedPath(path) {
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil || !sameDevice(info, device, deviceKnown) {
+			continue
+		}
+		if time.Since(info.ModTime()) < s.openFiles.ageGuard(dir.MinAge, info) {
+			continue
+		}
+
+		file := FileInfo{
+			Path:           path,
+			Size:           s.dirSize(path, device, deviceKnown),
+			Name:           name,
+			Location:       dir.Location,
+			NeedsElevation: dir.NeedsElevation,
+			RuleID:         dir.RuleID,
+			FileID:         registerScannedFile(dir, path, info),
+			OriginalPath:   source,
+		}
+		if openedBy := s.openFiles.openedBy(path); len(openedBy) > 0 {
+			s.addSkipped(SkippedFile{File: file, Reason: SkipInUse, OpenedBy: openedBy})
+			continue
+		}
+		files = append(files, file)
+		totalSize += file.Size
+	}
+
+	return files, totalSize
+}
+
+// orphanedWorkspace reads a workspaceStorage entry's workspace.json and reports
+// whether the folder (or .code-workspace file) it was for no longer exists. Remote
+// workspaces, and local ones on a volume that isn't mounted, never count as orphaned.
+func orphanedWorkspace(entry string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(entry, "workspace.json"))
+	if err != nil {
+		return "", false
+	}
+
+	var workspace struct {
+		Folder    string `json:"folder"`
+		Workspace string `json:"workspace"`
+	}
+	if err := json.Unmarshal(data, &workspace); err != nil {
+		return "", false
+	}
+
+	uri := workspace.Folder
+	if uri == "" {
+		uri = workspace.Workspace
+	}
+	target, ok := fileURIPath(uri)
+	if !ok {
+		return "", false
+	}
+
+	if _, err := os.Stat(target); !errors.Is(err, os.ErrNotExist) {
+		return target, false
+	}
+	if _, err := os.Stat(filepath.Dir(target)); err != nil {
+		return target, false
+	}
+	return target, true
+}
+
+// fileURIPath converts a file:// URI to a local path
+func fileURIPath(uri string) (string, bool) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" || parsed.Path == "" {
+		return "", false
+	}
+
+	path := parsed.Path
+	if runtime.GOOS == "windows" {
+		// file:///c%3A/Users/... and file://server/share/...
+		path = strings.TrimPrefix(path, "/")
+		if parsed.Host != "" {
+			path = `\\` + parsed.Host + `\` + path
+		}
+	}
+	path = filepath.FromSlash(path)
+	return path, filepath.IsAbs(path)
+}
+
+// uninstalledExtensions returns the lowercased IDs of the extensions that the editor
+// owning a globalStorage dir recorded as uninstalled in the .obsolete file of its
+// extensions dir, unless another version is still installed. Extensions built into
+// the editor are never recorded there, so their storage is never offered. It returns
+// nil if the extensions dir or its record can't be read.
+func uninstalledExtensions(globalStorage string) map[string]bool {
+	dataDir := filepath.Dir(filepath.Dir(globalStorage))
+	home := userHomeDir()
+
+	for _, editor := range codeEditors {
+		for _, candidate := range editor.dataDirs() {
+			if candidate != dataDir || home == "" {
+				continue
+			}
+
+			extensionsDir := filepath.Join(home, filepath.FromSlash(editor.extensions))
+			data, err := os.ReadFile(filepath.Join(extensionsDir, ".obsolete"))
+			if err != nil {
+				return nil
+			}
+			var obsolete map[string]bool
+			if err := json.Unmarshal(data, &obsolete); err != nil {
+				return nil
+			}
+			entries, err := os.ReadDir(extensionsDir)
+			if err != nil {
+				return nil
+			}
+
+			uninstalled := map[string]bool{}
+			for dirName, removed := range obsolete {
+				if removed {
+					uninstalled[extensionID(dirName)] = true
+				}
+			}
+			for _, entry := range entries {
+				if entry.IsDir() && !obsolete[entry.Name()] {
+					delete(uninstalled, extensionID(entry.Name()))
+				}
+			}
+			return uninstalled
+		}
+	}
+	return nil
+}
+
+// extensionID strips the version from an extension directory name such as
+// "golang.go-0.41.4" or "ms-python.python-2024.8.0-linux-x64"
+func extensionID(dirName string) string {
+	id := dirName
+	for i := 0; i < len(dirName)-1; i++ {
+		if dirName[i] == '-' && isDigit(dirName[i+1]) && strings.Contains(dirName[:i], ".") {
+			id = dirName[:i]
+			break
+		}
+	}
+	return strings.ToLower(id)
+}
@@ -0,0 +1,94 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestExtensionID(t *testing.T) {
+	cases := map[string]string{
+		"golang.go-0.41.4":                    "golang.go",
+		"ms-python.python-2024.8.0-linux-x64": "ms-python.python",
+		"GitHub.Copilot-1.200.0":              "github.copilot",
+		"esbenp.prettier-vscode-10.4.0":       "esbenp.prettier-vscode",
+		"not-an-extension":                    "not-an-extension",
+	}
+	for name, want := range cases {
+		if got := extensionID(name); got != want {
+			t.Errorf("extensionID(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestScanCodeStorage(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("editor paths are set up for Linux")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	projects := filepath.Join(home, "projects")
+	write := func(path, data string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := filepath.Join(home, ".config", "Code", "User")
+	workspaces := filepath.Join(user, "workspaceStorage")
+	write(filepath.Join(projects, "kept", "main.go"), "")
+	write(filepath.Join(workspaces, "aaa", "workspace.json"), `{"folder":"file://`+filepath.Join(projects, "kept")+`"}`)
+	write(filepath.Join(workspaces, "bbb", "workspace.json"), `{"folder":"file://`+filepath.Join(projects, "gone%20away")+`"}`)
+	write(filepath.Join(workspaces, "bbb", "state.vscdb"), "state")
+	write(filepath.Join(workspaces, "ccc", "workspace.json"), `{"folder":"file:///media/not-mounted/project"}`)
+	write(filepath.Join(workspaces, "ddd", "workspace.json"), `{"folder":"vscode-remote://ssh-remote+host/srv/gone"}`)
+
+	// golang.go was updated, rust-analyzer uninstalled and anysphere.cursor-retrieval
+	// is built in like the editor's own, so it never shows up in the extensions dir
+	global := filepath.Join(user, "globalStorage")
+	extensions := filepath.Join(home, ".vscode", "extensions")
+	write(filepath.Join(extensions, "golang.go-0.41.4", "package.json"), "{}")
+	write(filepath.Join(extensions, "golang.go-0.40.0", "package.json"), "{}")
+	write(filepath.Join(extensions, ".obsolete"), `{"golang.go-0.40.0":true,"rust-lang.rust-analyzer-0.3.1":true}`)
+	write(filepath.Join(global, "golang.go", "tools.json"), "{}")
+	write(filepath.Join(global, "rust-lang.rust-analyzer", "server"), "binary")
+	write(filepath.Join(global, "vscode.git", "askpass.sh"), "")
+	write(filepath.Join(global, "anysphere.cursor-retrieval", "index.db"), "")
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, dir := range []string{"aaa", "bbb", "ccc", "ddd"} {
+		os.Chtimes(filepath.Join(workspaces, dir), old, old)
+	}
+	for _, dir := range []string{"golang.go", "rust-lang.rust-analyzer", "vscode.git", "anysphere.cursor-retrieval"} {
+		os.Chtimes(filepath.Join(global, dir), old, old)
+	}
+
+	scanner := newCleanerScanner(context.Background(), nil)
+	files, size := scanner.scanCodeStorage(DirInfo{Path: workspaces, Location: "VS Code Storage", RuleID: "vscode-storage"})
+	if len(files) != 1 || files[0].Path != filepath.Join(workspaces, "bbb") {
+		t.Fatalf("Expected only the workspace of the deleted folder, got: %+v", files)
+	}
+	if files[0].OriginalPath != filepath.Join(projects, "gone away") || size != int64(len("state")+len(`{"folder":"file://`+filepath.Join(projects, "gone%20away")+`"}`)) {
+		t.Errorf("Unexpected orphaned workspace: %+v (size %d)", files[0], size)
+	}
+
+	files, _ = scanner.scanCodeStorage(DirInfo{Path: global, Location: "VS Code Storage", RuleID: "vscode-storage"})
+	if len(files) != 1 || files[0].Path != filepath.Join(global, "rust-lang.rust-analyzer") {
+		t.Fatalf("Expected only the uninstalled extension, got: %+v", files)
+	}
+
+	// Without the editor's record of uninstalled extensions nothing is offered
+	os.Remove(filepath.Join(extensions, ".obsolete"))
+	if files, _ = scanner.scanCodeStorage(DirInfo{Path: global}); len(files) != 0 {
+		t.Errorf("Expected no global storage without an uninstall record, got: %+v", files)
+	}
+}
@@ -0,0 +1,54 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const appDirName = "sysinfopro"
+
+// appConfigDir returns the per-user directory where settings are stored, creating it if needed
+func appConfigDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(base, appDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// appDataDir returns the per-user directory where app state (quarantine, logs) is kept,
+// creating it if needed
+func appDataDir() (string, error) {
+	var base string
+
+	switch runtime.GOOS {
+	case "windows":
+		base = os.Getenv("LOCALAPPDATA")
+	case "darwin":
+		base = filepath.Join(os.Getenv("HOME"), "Library", "Application Support")
+	default:
+		base = os.Getenv("XDG_DATA_HOME")
+		if base == "" {
+			base = filepath.Join(os.Getenv("HOME"), ".local", "share")
+		}
+	}
+
+	if base == "" {
+		var err error
+		if base, err = os.UserConfigDir(); err != nil {
+			return "", err
+		}
+	}
+
+	dir := filepath.Join(base, appDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
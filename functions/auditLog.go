@@ -0,0 +1,275 @@
+package functions
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const auditLogFile = "audit.jsonl"
+
+// AuditOutcome is what happened to one item of a clean run
+type AuditOutcome string
+
+// The outcomes are the CleanItemStatus of each item
+const (
+	AuditRemoved     AuditOutcome = AuditOutcome(StatusRemoved)
+	AuditTruncated   AuditOutcome = AuditOutcome(StatusTruncated)
+	AuditQuarantined AuditOutcome = AuditOutcome(StatusQuarantined)
+	AuditTrashed     AuditOutcome = AuditOutcome(StatusTrashed)
+	AuditLinked      AuditOutcome = AuditOutcome(StatusLinked)
+	AuditCompressed  AuditOutcome = AuditOutcome(StatusCompressed)
+	AuditSkipped     AuditOutcome = AuditOutcome(StatusSkipped)
+	AuditFailed      AuditOutcome = AuditOutcome(StatusFailed)
+)
+
+// AuditItem records the fate of one file of a clean run
+type AuditItem struct {
+	Path     string       `json:"path"`
+	Size     int64        `json:"size"`
+	Category string       `json:"category"`
+	Outcome  AuditOutcome `json:"outcome"`
+	Reason   SkipReason   `json:"reason,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// AuditRun is one line of the audit log: a single clean run
+type AuditRun struct {
+	RunID     string    `json:"runId"`
+	Timestamp time.Time `json:"timestamp"`
+	User      string    `json:"user"`
+	Elevated  bool      `json:"elevated"`
+	// Action is the clean mode, or "hardlink" for duplicate hardlinking
+	Action            string      `json:"action"`
+	QuarantineBatchID string      `json:"quarantineBatchId,omitempty"`
+	Items             []AuditItem `json:"items"`
+	// RemovedCount counts every item the run took care of, however it did
+	RemovedCount int `json:"removedCount"`
+	// RemovedSize is the space the run freed: quarantined and trashed files still
+	// take theirs, compressed ones only give back what compression saved
+	RemovedSize  int64 `json:"removedSize"`
+	SkippedCount int   `json:"skippedCount"`
+	FailedCount  int   `json:"failedCount"`
+}
+
+// AuditQuery filters the audit log. Zero fields don't filter.
+type AuditQuery struct {
+	Category string    `json:"category"`
+	Path     string    `json:"path"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+	Limit    int       `json:"limit"`
+}
+
+// AuditTotals sums every run in the audit log
+type AuditTotals struct {
+	Runs           int   `json:"runs"`
+	RemovedItems   int   `json:"removedItems"`
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+}
+
+// auditMu keeps concurrent runs from interleaving their lines
+var auditMu sync.Mutex
+
+// auditRecorder turns the report of a run into a line of the audit log
+type auditRecorder struct {
+	run AuditRun
+}
+
+func newAuditRecorder(action string) *auditRecorder {
+	now := time.Now()
+	return &auditRecorder{run: AuditRun{
+		RunID:     fmt.Sprintf("%s-%09d", now.Format("20060102-150405"), now.Nanosecond()),
+		Timestamp: now,
+		User:      currentUserName(),
+		Elevated:  checkPermissions().IsElevated,
+		Action:    action,
+		Items:     []AuditItem{},
+	}}
+}
+
+// finish records the items of report, writes the run and links it from report. A
+// failed write is reported as a run error.
+func (r *auditRecorder) finish(report *CleanReport) {
+	for _, item := range report.Items {
+		auditItem := AuditItem{
+			Path:     item.Path,
+			Size:     item.Bytes,
+			Category: item.Category,
+			Outcome:  AuditOutcome(item.Status),
+			Reason:   item.Reason,
+			Error:    item.OSError,
+		}
+		switch item.Status {
+		case StatusSkipped:
+			r.run.SkippedCount++
+		case StatusFailed:
+			r.run.FailedCount++
+		case StatusQuarantined, StatusTrashed:
+			r.run.RemovedCount++
+		default:
+			r.run.RemovedCount++
+			r.run.RemovedSize += item.Bytes
+		}
+		r.run.Items = append(r.run.Items, auditItem)
+	}
+
+	r.run.QuarantineBatchID = report.QuarantineBatchID
+	if err := r.write(); err != nil {
+		report.runFailed(ErrorAuditLogFailed, err)
+		return
+	}
+	if len(r.run.Items) > 0 {
+		report.AuditRunID = r.run.RunID
+	}
+}
+
+// write appends the run to the audit log; empty runs aren't recorded
+func (r *auditRecorder) write() error {
+	if len(r.run.Items) == 0 {
+		return nil
+	}
+
+	path, err := AuditLogPath()
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(r.run)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return f.Sync()
+}
+
+// AuditLogPath returns where the audit log is kept
+func AuditLogPath() (string, error) {
+	dir, err := appDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, auditLogFile), nil
+}
+
+// QueryAuditLog returns the runs matching query, newest first. With a category or
+// path filter only the matching items of each run are returned.
+func QueryAuditLog(query AuditQuery) ([]AuditRun, error) {
+	runs := []AuditRun{}
+	err := readAuditLog(func(run AuditRun) {
+		if !query.Since.IsZero() && run.Timestamp.Before(query.Since) {
+			return
+		}
+		if !query.Until.IsZero() && run.Timestamp.After(query.Until) {
+			return
+		}
+
+		if query.Category != "" || query.Path != "" {
+			items := []AuditItem{}
+			for _, item := range run.Items {
+				if query.Category != "" && item.Category != query.Category {
+					continue
+				}
+				if query.Path != "" && !isWithin(item.Path, query.Path) && !isWithin(query.Path, item.Path) {
+					continue
+				}
+				items = append(items, item)
+			}
+			if len(items) == 0 {
+				return
+			}
+			run.Items = items
+		}
+
+		runs = append(runs, run)
+	})
+
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Timestamp.After(runs[j].Timestamp) })
+	if query.Limit > 0 && len(runs) > query.Limit {
+		runs = runs[:query.Limit]
+	}
+	return runs, err
+}
+
+// GetAuditTotals returns the totals over the whole audit log
+func GetAuditTotals() (AuditTotals, error) {
+	var totals AuditTotals
+	err := readAuditLog(func(run AuditRun) {
+		totals.Runs++
+		totals.RemovedItems += run.RemovedCount
+		totals.ReclaimedBytes += run.RemovedSize
+	})
+	return totals, err
+}
+
+// readAuditLog calls fn for every run in the log. A line that can't be decoded (say,
+// cut short by a crash) is skipped rather than hiding the rest of the history.
+func readAuditLog(fn func(AuditRun)) error {
+	path, err := AuditLogPath()
+	if err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	// Runs with many items make for long lines, so read whole lines rather than tokens
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var run AuditRun
+			if json.Unmarshal(line, &run) == nil {
+				fn(run)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading audit log: %w", err)
+		}
+	}
+}
+
+func currentUserName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	for _, name := range []string{"USER", "USERNAME"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package functions
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanRunsAreAudited(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	var files []FileInfo
+	for _, name := range []string{"a.log", "b.log"} {
+		file := writeScannedFile(t, root, name, []byte("data"))
+		file.Location = "Logs"
+		files = append(files, file)
+	}
+	// Never registered by a scan, so it must be skipped
+	files = append(files, FileInfo{Path: filepath.Join(root, "c.log"), Size: 4, Location: "Other"})
+
+	summary := CleanFilesWithOptions(files, CleanOptions{})
+	if summary.CleanedCount != 2 || summary.AuditRunID == "" {
+		t.Fatalf("Expected two removed files and an audit run, got: %+v", summary)
+	}
+
+	runs, err := QueryAuditLog(AuditQuery{})
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("Expected one audited run, got %d (%v)", len(runs), err)
+	}
+	run := runs[0]
+	if run.RunID != summary.AuditRunID || run.Action != string(CleanModeDelete) || run.RemovedCount != 2 || run.SkippedCount != 1 {
+		t.Errorf("Unexpected audit run: %+v", run)
+	}
+
+	runs, _ = QueryAuditLog(AuditQuery{Category: "Other"})
+	if len(runs) != 1 || len(runs[0].Items) != 1 || runs[0].Items[0].Reason != SkipNotScanned {
+		t.Errorf("Expected the skipped item with its reason, got: %+v", runs)
+	}
+
+	runs, _ = QueryAuditLog(AuditQuery{Since: time.Now().Add(time.Hour)})
+	if len(runs) != 0 {
+		t.Errorf("Expected no runs in the future, got: %+v", runs)
+	}
+
+	totals, err := GetAuditTotals()
+	if err != nil || totals.Runs != 1 || totals.ReclaimedBytes != 8 {
+		t.Errorf("Expected 8 reclaimed bytes over one run, got: %+v (%v)", totals, err)
+	}
+}
+
+func TestAuditRecordsWhatHappenedToEachItem(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	file := func(name string, data []byte) FileInfo {
+		file := writeScannedFile(t, root, name, data)
+		file.Location = "Logs"
+		return file
+	}
+
+	cases := []struct {
+		mode    CleanMode
+		outcome AuditOutcome
+		freed   func(size int64) bool
+	}{
+		{CleanModeDelete, AuditRemoved, func(size int64) bool { return size == 4096 }},
+		{CleanModeQuarantine, AuditQuarantined, func(size int64) bool { return size == 0 }},
+		{CleanModeCompress, AuditCompressed, func(size int64) bool { return size > 0 && size < 4096 }},
+	}
+
+	for _, c := range cases {
+		summary := CleanFilesWithOptions([]FileInfo{file(string(c.mode)+".log", make([]byte, 4096))}, CleanOptions{Mode: c.mode})
+		if summary.CleanedCount != 1 {
+			t.Fatalf("%s: expected the file to be cleaned, got: %+v", c.mode, summary.Items)
+		}
+
+		runs, err := QueryAuditLog(AuditQuery{Limit: 1})
+		if err != nil || len(runs) != 1 || runs[0].RunID != summary.AuditRunID {
+			t.Fatalf("%s: expected the run to be audited, got %+v (%v)", c.mode, runs, err)
+		}
+		run := runs[0]
+		if len(run.Items) != 1 || run.Items[0].Outcome != c.outcome || run.RemovedCount != 1 {
+			t.Errorf("%s: expected outcome %s, got: %+v", c.mode, c.outcome, run)
+		}
+		if !c.freed(run.RemovedSize) {
+			t.Errorf("%s: unexpected freed size %d", c.mode, run.RemovedSize)
+		}
+	}
+}
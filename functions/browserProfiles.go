@@ -0,0 +1,246 @@
+package functions
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Browser providers only ever return the disposable cache subdirectories of a
+// profile. The profile directories themselves hold bookmarks, passwords, cookies
+// and history, so they are never returned as cleanable locations.
+
+var (
+	firefoxCacheDirNames  = []string{"cache2", "startupCache"}
+	chromiumCacheDirNames = []string{"Cache", "Code Cache", "GPUCache", filepath.Join("Service Worker", "CacheStorage")}
+)
+
+// chromiumBrowser names a Chromium based browser's user data directory on each OS,
+// relative to the config (Linux), Application Support (macOS) or LOCALAPPDATA (Windows) dir
+type chromiumBrowser struct {
+	linux   string
+	darwin  string
+	windows string
+}
+
+var (
+	chromeDirs   = chromiumBrowser{linux: "google-chrome", darwin: "Google/Chrome", windows: "Google/Chrome/User Data"}
+	chromiumDirs = chromiumBrowser{linux: "chromium", darwin: "Chromium", windows: "Chromium/User Data"}
+	edgeDirs     = chromiumBrowser{linux: "microsoft-edge", darwin: "Microsoft Edge", windows: "Microsoft/Edge/User Data"}
+	braveDirs    = chromiumBrowser{linux: "BraveSoftware/Brave-Browser", darwin: "BraveSoftware/Brave-Browser", windows: "BraveSoftware/Brave-Browser/User Data"}
+	vivaldiDirs  = chromiumBrowser{linux: "vivaldi", darwin: "Vivaldi", windows: "Vivaldi/User Data"}
+)
+
+// userDataDirs returns the browser's user data dir and, where the OS keeps caches
+// apart from it, the matching cache dir
+func (b chromiumBrowser) userDataDirs() (string, string) {
+	home := userHomeDir()
+
+	switch runtime.GOOS {
+	case "linux":
+		config, cache := rulePathVar("XDG_CONFIG_HOME"), rulePathVar("XDG_CACHE_HOME")
+		if config == "" || cache == "" {
+			return "", ""
+		}
+		return filepath.Join(config, filepath.FromSlash(b.linux)), filepath.Join(cache, filepath.FromSlash(b.linux))
+	case "darwin":
+		if home == "" {
+			return "", ""
+		}
+		return filepath.Join(home, "Library", "Application Support", filepath.FromSlash(b.darwin)),
+			filepath.Join(home, "Library", "Caches", filepath.FromSlash(b.darwin))
+	case "windows":
+		local := os.Getenv("LOCALAPPDATA")
+		if local == "" {
+			return "", ""
+		}
+		return filepath.Join(local, filepath.FromSlash(b.windows)), ""
+	}
+	return "", ""
+}
+
+// cacheDirs lists the cache subdirectories of every profile named in Local State
+func (b chromiumBrowser) cacheDirs() []ruleDir {
+	userData, cacheBase := b.userDataDirs()
+	if userData == "" {
+		return nil
+	}
+
+	var dirs []ruleDir
+	for _, profile := range chromiumProfiles(userData) {
+		for _, base := range []string{userData, cacheBase} {
+			if base == "" {
+				continue
+			}
+			for _, name := range chromiumCacheDirNames {
+				dirs = append(dirs, ruleDir{Path: filepath.Join(base, profile.dir, name), Profile: profile.name})
+			}
+		}
+	}
+	return dirs
+}
+
+type browserProfile struct {
+	dir  string
+	name string
+}
+
+// chromiumProfiles reads the profile directories and their display names from the
+// Local State file, falling back to Default when it can't be read
+func chromiumProfiles(userData string) []browserProfile {
+	fallback := []browserProfile{{dir: "Default", name: "Default"}}
+
+	data, err := os.ReadFile(filepath.Join(userData, "Local State"))
+	if err != nil {
+		return fallback
+	}
+
+	var state struct {
+		Profile struct {
+			InfoCache map[string]struct {
+				Name string `json:"name"`
+			} `json:"info_cache"`
+		} `json:"profile"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil || len(state.Profile.InfoCache) == 0 {
+		return fallback
+	}
+
+	var profiles []browserProfile
+	for dir, info := range state.Profile.InfoCache {
+		// A profile key is a single directory name below the user data dir
+		if dir == "" || dir != filepath.Base(dir) || dir == "." || dir == ".." {
+			continue
+		}
+		name := info.Name
+		if name == "" {
+			name = dir
+		}
+		profiles = append(profiles, browserProfile{dir: dir, name: name})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].dir < profiles[j].dir })
+	return profiles
+}
+
+// firefoxCacheDirs lists the cache subdirectories of every profile in profiles.ini.
+// Relative profiles keep their caches in a separate local directory on every OS.
+func firefoxCacheDirs() []ruleDir {
+	home := userHomeDir()
+
+	var roots [][2]string // profiles.ini dir, local cache dir
+	switch runtime.GOOS {
+	case "linux":
+		if cache := rulePathVar("XDG_CACHE_HOME"); home != "" && cache != "" {
+			roots = append(roots,
+				[2]string{filepath.Join(home, ".mozilla", "firefox"), filepath.Join(cache, "mozilla", "firefox")},
+				[2]string{filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox"), filepath.Join(home, "snap", "firefox", "common", ".cache", "mozilla", "firefox")},
+				[2]string{filepath.Join(home, ".var", "app", "org.mozilla.firefox", ".mozilla", "firefox"), filepath.Join(home, ".var", "app", "org.mozilla.firefox", "cache", "mozilla", "firefox")},
+			)
+		}
+	case "darwin":
+		if home != "" {
+			roots = append(roots, [2]string{
+				filepath.Join(home, "Library", "Application Support", "Firefox"),
+				filepath.Join(home, "Library", "Caches", "Firefox"),
+			})
+		}
+	case "windows":
+		appData, local := os.Getenv("APPDATA"), os.Getenv("LOCALAPPDATA")
+		if appData != "" && local != "" {
+			roots = append(roots, [2]string{
+				filepath.Join(appData, "Mozilla", "Firefox"),
+				filepath.Join(local, "Mozilla", "Firefox"),
+			})
+		}
+	}
+
+	var dirs []ruleDir
+	for _, root := range roots {
+		for _, profile := range firefoxProfiles(filepath.Join(root[0], "profiles.ini")) {
+			bases := []string{profile.dir}
+			if !filepath.IsAbs(profile.dir) {
+				bases = []string{filepath.Join(root[0], profile.dir), filepath.Join(root[1], profile.dir)}
+			}
+			for _, base := range bases {
+				for _, name := range firefoxCacheDirNames {
+					dirs = append(dirs, ruleDir{Path: filepath.Join(base, name), Profile: profile.name})
+				}
+			}
+		}
+	}
+	return dirs
+}
+
+type iniProfile struct {
+	name, path string
+	relative   bool
+}
+
+// firefoxProfiles parses the [ProfileN] sections of a profiles.ini. Relative profiles
+// are returned with a relative dir.
+func firefoxProfiles(iniPath string) []browserProfile {
+	f, err := os.Open(iniPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var profiles []browserProfile
+	var current *iniProfile
+	flush := func() {
+		if current == nil || current.path == "" {
+			return
+		}
+		dir := filepath.FromSlash(current.path)
+		if current.relative {
+			// A relative profile must stay below the Firefox directory
+			dir = filepath.Clean(dir)
+			if filepath.IsAbs(dir) || dir == "." || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+				return
+			}
+		} else if !filepath.IsAbs(dir) {
+			return
+		}
+		name := current.name
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+		profiles = append(profiles, browserProfile{dir: dir, name: name})
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			flush()
+			current = nil
+			if strings.HasPrefix(line, "[Profile") {
+				current = &iniProfile{relative: true}
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Name":
+			current.name = value
+		case "Path":
+			current.path = value
+		case "IsRelative":
+			current.relative = value != "0"
+		}
+	}
+	flush()
+
+	return profiles
+}
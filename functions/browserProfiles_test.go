@@ -0,0 +1,80 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestBrowserProvidersOnlyReturnCacheDirs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("profile locations below are the Linux ones")
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+
+	firefox := filepath.Join(home, ".mozilla", "firefox")
+	if err := os.MkdirAll(firefox, 0700); err != nil {
+		t.Fatal(err)
+	}
+	ini := "[General]\nStartWithLastProfile=1\n\n" +
+		"[Profile0]\nName=default-release\nIsRelative=1\nPath=abcd.default-release\n\n" +
+		"[Profile1]\nName=escape\nIsRelative=1\nPath=../../etc\n"
+	if err := os.WriteFile(filepath.Join(firefox, "profiles.ini"), []byte(ini), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := firefoxCacheDirs()
+	if len(dirs) == 0 {
+		t.Fatalf("Expected Firefox cache dirs, got none")
+	}
+	for _, dir := range dirs {
+		if dir.Profile != "default-release" {
+			t.Errorf("Unexpected profile %q for %s", dir.Profile, dir.Path)
+		}
+		if name := filepath.Base(dir.Path); name != "cache2" && name != "startupCache" {
+			t.Errorf("Expected only cache subdirectories, got: %s", dir.Path)
+		}
+	}
+	want := filepath.Join(home, ".cache", "mozilla", "firefox", "abcd.default-release", "cache2")
+	if !containsRuleDir(dirs, want) {
+		t.Errorf("Expected %s in %v", want, dirs)
+	}
+
+	chrome := filepath.Join(home, ".config", "google-chrome")
+	if err := os.MkdirAll(chrome, 0700); err != nil {
+		t.Fatal(err)
+	}
+	state := `{"profile": {"info_cache": {"Default": {"name": "Personal"}, "Profile 1": {"name": "Work"}, "../x": {"name": "Bad"}}}}`
+	if err := os.WriteFile(filepath.Join(chrome, "Local State"), []byte(state), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs = chromeDirs.cacheDirs()
+	profiles := map[string]bool{}
+	for _, dir := range dirs {
+		profiles[dir.Profile] = true
+		if filepath.Dir(dir.Path) == chrome || dir.Path == chrome {
+			t.Errorf("Expected only per-profile cache dirs, got: %s", dir.Path)
+		}
+	}
+	if !profiles["Personal"] || !profiles["Work"] || profiles["Bad"] {
+		t.Errorf("Expected the Personal and Work profiles only, got: %v", profiles)
+	}
+	if want := filepath.Join(chrome, "Profile 1", "Code Cache"); !containsRuleDir(dirs, want) {
+		t.Errorf("Expected %s in %v", want, dirs)
+	}
+}
+
+func containsRuleDir(dirs []ruleDir, path string) bool {
+	for _, dir := range dirs {
+		if dir.Path == path {
+			return true
+		}
+	}
+	return false
+}
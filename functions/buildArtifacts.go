@@ -0,0 +1,262 @@
+package functions
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	buildArtifactsCategory = "Build Artifacts"
+	// maxProjectFiles bounds the walk for a project's modification time, in case a
+	// marker turns up somewhere huge like the home directory
+	maxProjectFiles = 100000
+)
+
+// artifactKind recognizes a build output directory by the files next to it
+type artifactKind struct {
+	dir  string
+	kind string
+	// markers are globs matched against the names in the project directory
+	markers []string
+	// inside must exist in the artifact directory itself, if set
+	inside string
+}
+
+var (
+	gradleMarkers = []string{"build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts"}
+	pythonMarkers = []string{"pyproject.toml", "setup.py", "setup.cfg", "requirements.txt", "Pipfile"}
+
+	artifactKinds = []artifactKind{
+		{dir: "node_modules", kind: "node", markers: []string{"package.json"}},
+		{dir: "dist", kind: "node", markers: []string{"package.json"}},
+		{dir: "target", kind: "rust", markers: []string{"Cargo.toml"}},
+		{dir: "target", kind: "maven", markers: []string{"pom.xml"}},
+		{dir: "build", kind: "gradle", markers: gradleMarkers},
+		{dir: ".gradle", kind: "gradle", markers: gradleMarkers},
+		{dir: "__pycache__", kind: "python", markers: []string{"*.py"}},
+		{dir: ".venv", kind: "python", markers: pythonMarkers, inside: "pyvenv.cfg"},
+		{dir: "dist", kind: "python", markers: pythonMarkers},
+	}
+
+	// vcsDirs are never part of a project's sources
+	vcsDirs = map[string]bool{".git": true, ".hg": true, ".svn": true}
+)
+
+// ArtifactOptions configures FindBuildArtifacts
+type ArtifactOptions struct {
+	// Kinds limits the search to some kinds (node, rust, maven, gradle, python)
+	Kinds []string `json:"kinds"`
+	// MinIdleDays only reports projects whose sources are at least this old
+	MinIdleDays int `json:"minIdleDays"`
+}
+
+// BuildArtifact is a build output directory of a project
+type BuildArtifact struct {
+	Path        string `json:"path"`
+	Kind        string `json:"kind"`
+	ProjectPath string `json:"projectPath"`
+	Size        int64  `json:"size"`
+	// ProjectModified is the newest modification time of the project's own files
+	ProjectModified time.Time `json:"projectModified"`
+	// File is the entry to pass to CleanFiles
+	File FileInfo `json:"file"`
+}
+
+// ArtifactReport is the result of FindBuildArtifacts
+type ArtifactReport struct {
+	Artifacts []BuildArtifact `json:"artifacts"`
+	TotalSize int64           `json:"totalSize"`
+}
+
+// FindBuildArtifacts looks below roots for build output directories, recognized by
+// the marker files of their project (a package.json next to node_modules, a
+// Cargo.toml next to target, ...). Artifacts aren't searched for nested artifacts.
+func FindBuildArtifacts(ctx context.Context, roots []string, options ArtifactOptions, progress ScanProgressFunc) (*ArtifactReport, error) {
+	kinds := map[string]bool{}
+	for _, kind := range options.Kinds {
+		kinds[kind] = true
+	}
+
+	scanner := newCleanerScanner(ctx, progress)
+	resetScannedFiles(scopeArtifacts)
+	var artifacts []BuildArtifact
+	scanRoots := map[string]string{}
+
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		if isProtectedPath(root) {
+			return nil, fmt.Errorf("refusing to scan protected path: %s", root)
+		}
+
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if vcsDirs[d.Name()] || isProtectedPath(path) {
+				return filepath.SkipDir
+			}
+			scanner.report(path, false)
+
+			if path == root {
+				return nil
+			}
+			if kind, ok := matchArtifact(path, d.Name(), kinds); ok {
+				artifacts = append(artifacts, BuildArtifact{Path: path, Kind: kind, ProjectPath: filepath.Dir(path)})
+				scanRoots[path] = root
+				return filepath.SkipDir
+			}
+			// Everything below node_modules belongs to it, even without a marker
+			if d.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &ArtifactReport{Artifacts: []BuildArtifact{}}
+	projectTimes := map[string]time.Time{}
+	minIdle := time.Duration(options.MinIdleDays) * 24 * time.Hour
+
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		modified, known := projectTimes[artifact.ProjectPath]
+		if !known {
+			modified = projectModified(artifact.ProjectPath)
+			projectTimes[artifact.ProjectPath] = modified
+		}
+		artifact.ProjectModified = modified
+	}
+
+	// Size the artifacts concurrently
+	var wg sync.WaitGroup
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		if minIdle > 0 && time.Since(artifact.ProjectModified) < minIdle {
+			continue
+		}
+
+		info, err := os.Lstat(artifact.Path)
+		if err != nil {
+			continue
+		}
+		device, deviceKnown := deviceOf(info)
+		artifact.File = FileInfo{
+			Path:     artifact.Path,
+			Name:     filepath.Base(artifact.ProjectPath) + "/" + filepath.Base(artifact.Path),
+			Location: buildArtifactsCategory,
+			FileID:   registerScopedFile(scopeArtifacts, scanRoots[artifact.Path], "", artifact.Path, info),
+		}
+
+		scanner.workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-scanner.workers }()
+			artifact.Size = scanner.dirSize(artifact.Path, device, deviceKnown)
+			artifact.File.Size = artifact.Size
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, artifact := range artifacts {
+		if artifact.File.Path == "" {
+			continue
+		}
+		report.Artifacts = append(report.Artifacts, artifact)
+		report.TotalSize += artifact.Size
+	}
+	sort.Slice(report.Artifacts, func(i, j int) bool { return report.Artifacts[i].Size > report.Artifacts[j].Size })
+
+	scanner.report("", true)
+	return report, nil
+}
+
+// matchArtifact reports whether the directory at path is the build output of the
+// project it sits in, and of which kind
+func matchArtifact(path, name string, kinds map[string]bool) (string, bool) {
+	var siblings []string
+	for _, kind := range artifactKinds {
+		if kind.dir != name || (len(kinds) > 0 && !kinds[kind.kind]) {
+			continue
+		}
+		if kind.inside != "" {
+			if _, err := os.Lstat(filepath.Join(path, kind.inside)); err != nil {
+				continue
+			}
+		}
+
+		if siblings == nil {
+			entries, err := os.ReadDir(filepath.Dir(path))
+			if err != nil {
+				return "", false
+			}
+			siblings = make([]string, 0, len(entries))
+			for _, entry := range entries {
+				if entry.Type().IsRegular() {
+					siblings = append(siblings, entry.Name())
+				}
+			}
+		}
+
+		for _, marker := range kind.markers {
+			for _, sibling := range siblings {
+				if ok, _ := filepath.Match(marker, sibling); ok {
+					return kind.kind, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// projectModified returns the newest modification time of the files of a project,
+// leaving out its build outputs and version control data
+func projectModified(project string) time.Time {
+	outputs := map[string]bool{}
+	for _, kind := range artifactKinds {
+		outputs[kind.dir] = true
+	}
+
+	var newest time.Time
+	visited := 0
+	filepath.WalkDir(project, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if visited++; visited > maxProjectFiles {
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			if path != project && (outputs[d.Name()] || vcsDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest
+}
@@ -0,0 +1,75 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindBuildArtifacts(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	write := func(rel, data string) {
+		writeTestFile(t, filepath.Join(root, filepath.FromSlash(rel)), []byte(data))
+	}
+
+	write("web/package.json", "{}")
+	write("web/src/index.js", "")
+	write("web/node_modules/left-pad/index.js", "module.exports = 1")
+	write("web/node_modules/left-pad/node_modules/dep/package.json", "{}")
+	write("crate/Cargo.toml", "")
+	write("crate/target/debug/app", "binary")
+	write("notes/target/plan.txt", "not a build output")
+	write("tool/main.py", "")
+	write("tool/__pycache__/main.cpython-312.pyc", "bytecode")
+	write("tool/.venv/lib/site.py", "")
+
+	// The web project hasn't been touched in a year, the crate was just edited
+	old := time.Now().AddDate(-1, 0, 0)
+	for _, rel := range []string{"web/package.json", "web/src/index.js", "web/node_modules", "tool/main.py"} {
+		os.Chtimes(filepath.Join(root, filepath.FromSlash(rel)), old, old)
+	}
+
+	report, err := FindBuildArtifacts(context.Background(), []string{root}, ArtifactOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]BuildArtifact{}
+	for _, artifact := range report.Artifacts {
+		rel, _ := filepath.Rel(root, artifact.Path)
+		found[filepath.ToSlash(rel)] = artifact
+	}
+	if len(found) != 3 {
+		t.Fatalf("Expected node_modules, target and __pycache__, got: %v", found)
+	}
+	nodeModules, ok := found["web/node_modules"]
+	if !ok || nodeModules.Kind != "node" || nodeModules.Size != int64(len("module.exports = 1")+len("{}")) {
+		t.Errorf("Unexpected node_modules artifact: %+v", nodeModules)
+	}
+	if !nodeModules.ProjectModified.Equal(old) {
+		t.Errorf("Expected the project time to ignore node_modules, got %v", nodeModules.ProjectModified)
+	}
+	if found["crate/target"].Kind != "rust" || found["tool/__pycache__"].Kind != "python" {
+		t.Errorf("Unexpected kinds: %+v", found)
+	}
+
+	report, err = FindBuildArtifacts(context.Background(), []string{root}, ArtifactOptions{Kinds: []string{"node", "rust"}, MinIdleDays: 30}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Artifacts) != 1 || report.Artifacts[0].Path != nodeModules.Path {
+		t.Fatalf("Expected only the idle node_modules, got: %+v", report.Artifacts)
+	}
+
+	cleaned := CleanFilesWithOptions([]FileInfo{report.Artifacts[0].File}, CleanOptions{})
+	if cleaned.CleanedCount != 1 {
+		t.Fatalf("Expected node_modules to be cleaned, got: %+v", cleaned)
+	}
+	if _, err := os.Stat(nodeModules.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got: %v", nodeModules.Path, err)
+	}
+}
@@ -0,0 +1,375 @@
+package functions
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The clean helper is a separate binary that removes files needing root on behalf of
+// the unprivileged app. It is started through pkexec and speaks JSON lines: it sends
+// a cleanHelperHello, then answers each cleanHelperRequest read from stdin with a
+// cleanHelperResponse as soon as the item is done, and exits when stdin is closed.
+const (
+	cleanHelperName            = "sysinfopro-cleanhelper"
+	cleanHelperProtocolVersion = 1
+
+	helperOpDelete   = "delete"
+	helperOpTruncate = "truncate"
+)
+
+// cleanHelperInstallPath is the only place the helper is run from. pkexec runs it as
+// root, so it must not be replaceable by the user: the policy in
+// build/linux/com.sysinfopro.cleanhelper.policy authorizes exactly this path.
+var cleanHelperInstallPath = "/usr/libexec/" + cleanHelperName
+
+type cleanHelperHello struct {
+	Version int      `json:"version"`
+	Roots   []string `json:"roots"`
+}
+
+type cleanHelperRequest struct {
+	ID   int    `json:"id"`
+	Op   string `json:"op"`
+	Path string `json:"path"`
+}
+
+type cleanHelperResponse struct {
+	ID int `json:"id"`
+	CleanItemResult
+}
+
+// ServeCleanHelper runs the helper side of the protocol. Only the built-in rules that
+// require elevation are trusted, never the user's overrides, and every path is checked
+// again here, whatever the app decided.
+func ServeCleanHelper(in io.Reader, out io.Writer) error {
+	roots, err := elevatedCleanerRoots()
+	if err != nil {
+		return err
+	}
+	// As root the helper sees every process, so its index is complete
+	openFiles := buildOpenFileIndex()
+
+	writer := bufio.NewWriter(out)
+	encoder := json.NewEncoder(writer)
+
+	hello := cleanHelperHello{Version: cleanHelperProtocolVersion, Roots: []string{}}
+	for _, root := range roots {
+		hello.Roots = append(hello.Roots, root.Path)
+	}
+	if err := encoder.Encode(hello); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(in)
+	for {
+		var request cleanHelperRequest
+		if err := decoder.Decode(&request); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("error reading request: %w", err)
+		}
+
+		response := cleanHelperResponse{ID: request.ID, CleanItemResult: serveCleanHelperRequest(request, roots, openFiles)}
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// elevatedCleanerRoots returns the directories of the built-in rules that require elevation
+func elevatedCleanerRoots() ([]DirInfo, error) {
+	rules, err := builtInCleanerRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []DirInfo
+	for _, dir := range cleanerDirs(rules) {
+		if dir.rule.RequiresElevation {
+			roots = append(roots, dir)
+		}
+	}
+	return roots, nil
+}
+
+func serveCleanHelperRequest(request cleanHelperRequest, roots []DirInfo, openFiles *openFileIndex) CleanItemResult {
+	result := CleanItemResult{Path: request.Path, Status: StatusSkipped}
+
+	root, reason, ok := validateHelperRequest(request, roots)
+	if !ok {
+		result.Reason = reason
+		return result
+	}
+	result.Category = root.Location
+
+	// From here on the entry is only touched through descriptors, never by path
+	entry, err := openHelperEntry(root.Path, request.Path)
+	if err != nil {
+		result.Reason = SkipInvalidPath
+		return result
+	}
+	defer entry.close()
+	result.Bytes = entry.size
+
+	truncate := request.Op == helperOpTruncate
+	if !helperRuleAllows(root, request.Path, entry.mode, truncate) {
+		result.Reason = SkipInvalidPath
+		return result
+	}
+
+	// The app's safety checks are repeated here rather than trusted. Live logs are
+	// truncated because they are open, so those two checks don't apply to them.
+	if !truncate {
+		ruleMinAge, _ := root.rule.minAge()
+		if time.Since(entry.modTime) < openFiles.ageGuard(ruleMinAge, nil) {
+			result.Reason = SkipRecentlyModified
+			return result
+		}
+		if openedBy := openFiles.openedBy(request.Path); len(openedBy) > 0 {
+			result.Reason, result.OpenedBy = SkipInUse, openedBy
+			return result
+		}
+	}
+
+	if truncate {
+		err = entry.truncate()
+		result.Status = StatusTruncated
+	} else {
+		err = entry.remove()
+		result.Status = StatusRemoved
+	}
+
+	if err != nil {
+		result.Status = StatusFailed
+		result.ErrorCode = cleanErrorCode(err)
+		result.OSError = err.Error()
+	}
+	return result
+}
+
+// validateHelperRequest checks that a request names an entry below one of the
+// elevated roots, before anything is opened
+func validateHelperRequest(request cleanHelperRequest, roots []DirInfo) (DirInfo, SkipReason, bool) {
+	path := request.Path
+	if request.Op != helperOpDelete && request.Op != helperOpTruncate {
+		return DirInfo{}, SkipInvalidPath, false
+	}
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+		return DirInfo{}, SkipInvalidPath, false
+	}
+
+	// The innermost root wins, so /var/log/journal isn't treated as a plain log
+	var root DirInfo
+	found := false
+	for _, candidate := range roots {
+		if path != candidate.Path && isWithin(candidate.Path, path) && len(candidate.Path) > len(root.Path) {
+			root, found = candidate, true
+		}
+	}
+	if !found {
+		return DirInfo{}, SkipOutsideScanRoot, false
+	}
+
+	if _, protected := protectionBelow(path); protected {
+		return root, SkipCriticalFile, false
+	}
+	return root, "", true
+}
+
+// helperRuleAllows applies the same selection as the scan of the root's rule
+func helperRuleAllows(root DirInfo, path string, mode os.FileMode, truncate bool) bool {
+	name := filepath.Base(path)
+
+	switch root.rule.Provider {
+	case "rotated-logs":
+		if !mode.IsRegular() || strings.HasPrefix(path, journalLogDir+string(filepath.Separator)) {
+			return false
+		}
+		_, rotated := rotatedLogBase(name)
+		if truncate {
+			return !rotated && isTextLog(name)
+		}
+		return rotated
+	case "systemd-journal":
+		_, archived := archivedJournal(name)
+		return !truncate && mode.IsRegular() && archived
+	case "pacman-cache":
+		if truncate || !mode.IsRegular() || filepath.Dir(path) != root.Path {
+			return false
+		}
+		_, isPackage := parsePacmanPackage(strings.TrimSuffix(name, ".sig"))
+		return isPackage
+	}
+
+	if truncate {
+		return false
+	}
+	// Other rules offer the top-level entries of their directories
+	rel, err := filepath.Rel(root.Path, path)
+	if err != nil {
+		return false
+	}
+	top := strings.Split(rel, string(filepath.Separator))[0]
+	return root.rule.matches(top)
+}
+
+// cleanHelperPath returns the installed helper if it can only have been put there by root
+func cleanHelperPath() (string, error) {
+	if err := checkRootOwned(cleanHelperInstallPath); err != nil {
+		return "", fmt.Errorf("%s is not usable: %w", cleanHelperName, err)
+	}
+	return cleanHelperInstallPath, nil
+}
+
+// checkRootOwned makes sure a file, and every directory above it, is owned by root
+// and not writable by group or others, so no other user could have replaced it
+func checkRootOwned(path string) error {
+	for current := path; ; current = filepath.Dir(current) {
+		info, err := os.Lstat(current)
+		if err != nil {
+			return err
+		}
+		if current == path && !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", current)
+		}
+		if !ownedByRoot(info) {
+			return fmt.Errorf("%s is not owned by root", current)
+		}
+		if info.Mode().Perm()&0022 != 0 {
+			return fmt.Errorf("%s is writable by group or others", current)
+		}
+		if parent := filepath.Dir(current); parent == current {
+			return nil
+		}
+	}
+}
+
+// cleanHelperAvailable reports whether files needing root can be cleaned through the helper
+func cleanHelperAvailable() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if _, err := exec.LookPath("pkexec"); err != nil {
+		return false
+	}
+	_, err := cleanHelperPath()
+	return err == nil
+}
+
+// runCleanHelper removes files through the helper and returns the result of each,
+// in the order of files. Files the helper never answered for are reported as failed.
+func runCleanHelper(files []FileInfo) ([]CleanItemResult, error) {
+	results := make([]CleanItemResult, len(files))
+	for i, file := range files {
+		results[i] = CleanItemResult{
+			Path:      file.Path,
+			Category:  file.Location,
+			Bytes:     file.Size,
+			Status:    StatusFailed,
+			ErrorCode: ErrorElevationFailed,
+		}
+	}
+
+	err := startCleanHelper(files, func(response cleanHelperResponse) {
+		if response.ID < 0 || response.ID >= len(files) {
+			return
+		}
+		// The app's view of the category and size is what the rest of the report uses
+		response.Category = files[response.ID].Location
+		if response.Status != StatusSkipped && response.Status != StatusFailed {
+			response.Bytes = files[response.ID].Size
+		}
+		results[response.ID] = response.CleanItemResult
+	})
+	if err != nil {
+		for i := range results {
+			if results[i].ErrorCode == ErrorElevationFailed {
+				results[i].OSError = err.Error()
+			}
+		}
+	}
+	return results, err
+}
+
+func startCleanHelper(files []FileInfo, handle func(cleanHelperResponse)) error {
+	helper, err := cleanHelperPath()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("pkexec", helper)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting %s: %w", helper, err)
+	}
+
+	// Requests are written while responses are read so neither pipe can fill up
+	go func() {
+		defer stdin.Close()
+		encoder := json.NewEncoder(stdin)
+		for i, file := range files {
+			op := helperOpDelete
+			if file.Truncate {
+				op = helperOpTruncate
+			}
+			if encoder.Encode(cleanHelperRequest{ID: i, Op: op, Path: file.Path}) != nil {
+				return
+			}
+		}
+	}()
+
+	decoder := json.NewDecoder(stdout)
+	var hello cleanHelperHello
+	helloErr := decoder.Decode(&hello)
+	if helloErr == nil && hello.Version != cleanHelperProtocolVersion {
+		helloErr = fmt.Errorf("helper speaks protocol version %d, expected %d", hello.Version, cleanHelperProtocolVersion)
+	}
+	if helloErr == nil {
+		for {
+			var response cleanHelperResponse
+			if decoder.Decode(&response) != nil {
+				break
+			}
+			handle(response)
+		}
+	}
+	io.Copy(io.Discard, stdout)
+
+	// pkexec exits with 126 when authentication is dismissed and 127 when it fails
+	if err := cmd.Wait(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("error running %s: %w (%s)", helper, err, message)
+		}
+		return fmt.Errorf("error running %s: %w", helper, err)
+	}
+	if helloErr != nil {
+		return fmt.Errorf("error talking to %s: %w", helper, helloErr)
+	}
+	return nil
+}
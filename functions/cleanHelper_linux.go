@@ -0,0 +1,169 @@
+//go:build linux
+
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const helperOpenDirFlags = unix.O_RDONLY | unix.O_DIRECTORY | unix.O_NOFOLLOW | unix.O_CLOEXEC
+
+// helperEntry is an entry the helper reached from its root one component at a time,
+// held by a descriptor of its directory. Whatever happens to the path afterwards,
+// removing or truncating the entry can't end up somewhere else.
+type helperEntry struct {
+	dir     int
+	name    string
+	device  uint64
+	inode   uint64
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+}
+
+// openHelperEntry opens every directory from root down to path's parent with
+// O_NOFOLLOW, refusing symlinks and other filesystems on the way
+func openHelperEntry(root, path string) (*helperEntry, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, syscall.EINVAL
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+
+	dir, err := unix.Open(root, helperOpenDirFlags, 0)
+	if err != nil {
+		return nil, err
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(dir, &st); err != nil {
+		unix.Close(dir)
+		return nil, err
+	}
+	device := uint64(st.Dev)
+
+	for _, part := range parts[:len(parts)-1] {
+		next, err := unix.Openat(dir, part, helperOpenDirFlags, 0)
+		unix.Close(dir)
+		if err != nil {
+			return nil, err
+		}
+		dir = next
+		if err := unix.Fstat(dir, &st); err != nil || uint64(st.Dev) != device {
+			unix.Close(dir)
+			return nil, syscall.EXDEV
+		}
+	}
+
+	name := parts[len(parts)-1]
+	if err := unix.Fstatat(dir, name, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		unix.Close(dir)
+		return nil, err
+	}
+	if uint64(st.Dev) != device {
+		unix.Close(dir)
+		return nil, syscall.EXDEV
+	}
+
+	return &helperEntry{
+		dir:     dir,
+		name:    name,
+		device:  device,
+		inode:   uint64(st.Ino),
+		mode:    unixFileMode(st.Mode),
+		size:    st.Size,
+		modTime: time.Unix(st.Mtim.Unix()),
+	}, nil
+}
+
+func (e *helperEntry) close() {
+	unix.Close(e.dir)
+}
+
+// remove unlinks the entry. A directory is emptied first, again only through
+// descriptors, and never across a mount point.
+func (e *helperEntry) remove() error {
+	if e.mode.IsDir() {
+		return removeAllAt(e.dir, e.name, e.device)
+	}
+	return unix.Unlinkat(e.dir, e.name, 0)
+}
+
+// truncate empties the entry if it is still the regular file that was checked
+func (e *helperEntry) truncate() error {
+	fd, err := unix.Openat(e.dir, e.name, unix.O_WRONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return err
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFREG || uint64(st.Ino) != e.inode {
+		return syscall.ESTALE
+	}
+	return unix.Ftruncate(fd, 0)
+}
+
+func removeAllAt(parent int, name string, device uint64) error {
+	fd, err := unix.Openat(parent, name, helperOpenDirFlags, 0)
+	if err != nil {
+		return err
+	}
+	dir := os.NewFile(uintptr(fd), name)
+	defer dir.Close()
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return err
+	}
+	if uint64(st.Dev) != device {
+		return syscall.EXDEV
+	}
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, child := range names {
+		var childStat unix.Stat_t
+		if err := unix.Fstatat(fd, child, &childStat, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			continue
+		}
+		if childStat.Mode&unix.S_IFMT == unix.S_IFDIR {
+			err = removeAllAt(fd, child, device)
+		} else {
+			err = unix.Unlinkat(fd, child, 0)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return unix.Unlinkat(parent, name, unix.AT_REMOVEDIR)
+}
+
+func unixFileMode(mode uint32) os.FileMode {
+	perm := os.FileMode(mode & 0777)
+	switch mode & unix.S_IFMT {
+	case unix.S_IFREG:
+		return perm
+	case unix.S_IFDIR:
+		return perm | os.ModeDir
+	case unix.S_IFLNK:
+		return perm | os.ModeSymlink
+	default:
+		return perm | os.ModeIrregular
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package functions
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// helperEntry is only implemented on Linux, the one OS the clean helper runs on
+type helperEntry struct {
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+}
+
+func openHelperEntry(_, _ string) (*helperEntry, error) {
+	return nil, errors.New("the clean helper only runs on Linux")
+}
+
+func (e *helperEntry) close() {}
+
+func (e *helperEntry) remove() error {
+	return errors.ErrUnsupported
+}
+
+func (e *helperEntry) truncate() error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,173 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCleanHelperValidatesPaths(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the clean helper only runs on Linux")
+	}
+	root := t.TempDir()
+	logs := t.TempDir()
+	outside := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+
+	for path, data := range map[string]string{
+		filepath.Join(root, "cache.bin"):      "cache",
+		filepath.Join(root, "keep.txt"):       "keep",
+		filepath.Join(outside, "secret"):      "secret",
+		filepath.Join(logs, "syslog"):         "live",
+		filepath.Join(logs, "syslog.2.gz"):    "old",
+		filepath.Join(logs, "wtmp"):           "binary",
+		filepath.Join(root, "dir", "nested"):  "nested",
+		filepath.Join(outside, "other.bin"):   "other",
+		filepath.Join(root, "dir", "old.bin"): "old",
+		filepath.Join(root, "sub", "a.bin"):   "nested",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, old, old)
+	}
+	os.Chtimes(filepath.Join(root, "dir"), old, old)
+	if err := os.WriteFile(filepath.Join(root, "fresh.bin"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link.bin")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	roots := []DirInfo{
+		{Path: root, Location: "Cache", rule: CleanerRule{RequiresElevation: true, Exclude: []string{"*.txt"}}},
+		{Path: logs, Location: "System Logs", rule: CleanerRule{RequiresElevation: true, Provider: "rotated-logs"}},
+	}
+
+	cases := []struct {
+		op, path string
+		status   CleanItemStatus
+		reason   SkipReason
+	}{
+		{helperOpDelete, filepath.Join(root, "cache.bin"), StatusRemoved, ""},
+		{helperOpDelete, filepath.Join(root, "dir"), StatusRemoved, ""},
+		{helperOpDelete, filepath.Join(root, "sub", "a.bin"), StatusRemoved, ""},
+		{helperOpDelete, filepath.Join(root, "fresh.bin"), StatusSkipped, SkipRecentlyModified},
+		{helperOpDelete, filepath.Join(root, "keep.txt"), StatusSkipped, SkipInvalidPath},
+		{helperOpDelete, root, StatusSkipped, SkipOutsideScanRoot},
+		{helperOpDelete, filepath.Join(outside, "secret"), StatusSkipped, SkipOutsideScanRoot},
+		{helperOpDelete, root + string(filepath.Separator) + ".." + string(filepath.Separator) + "x", StatusSkipped, SkipInvalidPath},
+		{helperOpDelete, filepath.Join(root, "link.bin", "other.bin"), StatusSkipped, SkipInvalidPath},
+		{helperOpDelete, "relative/cache.bin", StatusSkipped, SkipInvalidPath},
+		{"chmod", filepath.Join(root, "cache.bin"), StatusSkipped, SkipInvalidPath},
+		{helperOpTruncate, filepath.Join(root, "keep.txt"), StatusSkipped, SkipInvalidPath},
+		{helperOpDelete, filepath.Join(logs, "syslog"), StatusSkipped, SkipInvalidPath},
+		{helperOpTruncate, filepath.Join(logs, "wtmp"), StatusSkipped, SkipInvalidPath},
+		{helperOpTruncate, filepath.Join(logs, "syslog"), StatusTruncated, ""},
+		{helperOpDelete, filepath.Join(logs, "syslog.2.gz"), StatusRemoved, ""},
+	}
+
+	for _, c := range cases {
+		result := serveCleanHelperRequest(cleanHelperRequest{Op: c.op, Path: c.path}, roots, nil)
+		if result.Status != c.status || result.Reason != c.reason {
+			t.Errorf("%s %s: got %s (%s), want %s (%s)", c.op, c.path, result.Status, result.Reason, c.status, c.reason)
+		}
+	}
+
+	// The helper asks /proc itself rather than trusting the app's scan
+	held := filepath.Join(logs, "syslog.2.gz")
+	os.WriteFile(held, []byte("old"), 0644)
+	os.Chtimes(held, old, old)
+	openFiles := &openFileIndex{holders: map[string][]ProcessRef{held: {{PID: 1, Name: "rsyslogd"}}}, sorted: []string{held}}
+	result := serveCleanHelperRequest(cleanHelperRequest{Op: helperOpDelete, Path: held}, roots, openFiles)
+	if result.Status != StatusSkipped || result.Reason != SkipInUse {
+		t.Errorf("Expected an open file to be skipped as in use, got %s (%s)", result.Status, result.Reason)
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "other.bin")); err != nil {
+		t.Errorf("Expected the file behind the symlink to survive: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(logs, "syslog")); err != nil || info.Size() != 0 {
+		t.Errorf("Expected syslog to be truncated, got %v (%v)", info, err)
+	}
+}
+
+func TestCleanHelperMustBeRootOwned(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no clean helper on Windows")
+	}
+
+	// Anything a user can write to, directly or through its directory, is refused
+	helper := filepath.Join(t.TempDir(), cleanHelperName)
+	if err := os.WriteFile(helper, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	saved := cleanHelperInstallPath
+	cleanHelperInstallPath = helper
+	defer func() { cleanHelperInstallPath = saved }()
+
+	if _, err := cleanHelperPath(); err == nil {
+		t.Errorf("Expected a helper in a temporary directory to be refused")
+	}
+	if cleanHelperAvailable() {
+		t.Errorf("Expected no helper to be available")
+	}
+
+	os.Chmod(helper, 0777)
+	if err := checkRootOwned(helper); err == nil {
+		t.Errorf("Expected a world-writable helper to be refused")
+	}
+
+	// A system binary is what an installed helper looks like
+	if info, err := os.Lstat("/usr/bin/env"); err == nil && info.Mode().IsRegular() {
+		if err := checkRootOwned("/usr/bin/env"); err != nil {
+			t.Errorf("Expected /usr/bin/env to count as root-owned: %v", err)
+		}
+	}
+}
+
+func TestElevatedRootsAreScannedForTheHelper(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "cache.bin")
+	if err := os.WriteFile(path, []byte("cache"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path, old, old)
+
+	permissions := PermissionStatus{HelperAvailable: true}
+	saved := checkPermissions
+	checkPermissions = func() PermissionStatus { return permissions }
+	defer func() { checkPermissions = saved }()
+
+	dir := DirInfo{Path: root, Location: "System Cache", RuleID: "system-cache", NeedsElevation: true,
+		rule: CleanerRule{ID: "system-cache", RequiresElevation: true}}
+	scan := func() []FileInfo {
+		result := CleanerResult{Files: map[string][]FileInfo{}, CategorySizes: map[string]int64{}, Permissions: permissions}
+		newCleanerScanner(context.Background(), nil).scanRoots(&result, []DirInfo{dir})
+		return result.Files["System Cache"]
+	}
+
+	files := scan()
+	if len(files) != 1 || !files[0].NeedsElevation {
+		t.Fatalf("Expected the elevated root to be scanned, got: %+v", files)
+	}
+
+	plan := planClean(files, CleanOptions{Mode: CleanModeDelete, Elevate: true})
+	if plan.RemoveCount != 1 || !plan.Items[0].Elevated {
+		t.Errorf("Expected the file to be planned for the helper, got: %+v", plan.Items)
+	}
+
+	// Without the helper the root isn't scanned at all
+	permissions.HelperAvailable = false
+	if files := scan(); len(files) != 0 {
+		t.Errorf("Expected no files without the helper, got: %+v", files)
+	}
+}
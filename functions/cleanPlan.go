@@ -0,0 +1,249 @@
+package functions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SkipReason explains why a file would not be (or was not) removed
+type SkipReason string
+
+const (
+	SkipRequiresElevation SkipReason = "requires_elevation"
+	SkipRecentlyModified  SkipReason = "recently_modified"
+	SkipCriticalFile      SkipReason = "critical_file"
+	SkipNoWritePermission SkipReason = "no_write_permission"
+	SkipInvalidPath       SkipReason = "invalid_path"
+	SkipNotScanned        SkipReason = "not_scanned"
+	SkipOutsideScanRoot   SkipReason = "outside_scan_root"
+	SkipFileChanged       SkipReason = "changed_since_scan"
+	SkipInUse             SkipReason = "in_use"
+	SkipUserExcluded      SkipReason = "user_excluded"
+	SkipNotDuplicate      SkipReason = "not_duplicate"
+	SkipLastCopy          SkipReason = "last_copy"
+	SkipDifferentGroup    SkipReason = "different_group"
+	SkipNotCompressible   SkipReason = "not_compressible"
+)
+
+// PlannedAction is what the cleaner would do with a file
+type PlannedAction string
+
+const (
+	ActionRemove PlannedAction = "remove"
+	ActionSkip   PlannedAction = "skip"
+)
+
+// CleanPlanItem describes the decision taken for a single file
+type CleanPlanItem struct {
+	File        FileInfo
+	Action      PlannedAction
+	Reason      SkipReason
+	OpenedBy    []ProcessRef
+	ProtectedBy *ProtectionRule
+	// Elevated items are removed by the privileged clean helper
+	Elevated bool
+}
+
+// CleanPlan is the result of a dry run of CleanFiles
+type CleanPlan struct {
+	Items         []CleanPlanItem
+	CategorySizes map[string]int64
+	TotalSize     int64
+	RemoveCount   int
+	SkipCount     int
+}
+
+// PlanCleanFiles runs the same checks as CleanFilesWithOptions without deleting
+// anything and returns what would be removed or skipped with those options
+func PlanCleanFiles(files []FileInfo, options CleanOptions) CleanPlan {
+	return planClean(files, options)
+}
+
+func planClean(files []FileInfo, options CleanOptions) CleanPlan {
+	plan := CleanPlan{
+		Items:         make([]CleanPlanItem, 0, len(files)),
+		CategorySizes: make(map[string]int64),
+	}
+
+	checks := newCleanChecks(files, options)
+
+	for _, file := range files {
+		item := CleanPlanItem{File: file, Action: ActionRemove}
+
+		if checks.check(&item) {
+			item.Action = ActionSkip
+			plan.SkipCount++
+		} else {
+			plan.CategorySizes[file.Location] += file.Size
+			plan.TotalSize += file.Size
+			plan.RemoveCount++
+		}
+
+		plan.Items = append(plan.Items, item)
+	}
+
+	// Selections may mix a directory with entries inside it
+	dropNestedItems(&plan)
+	return plan
+}
+
+// cleanChecks holds what the safety checks need, gathered once per run
+type cleanChecks struct {
+	permissions    *PermissionStatus
+	rules          map[string]CleanerRule
+	openFiles      *openFileIndex
+	allowOpenFiles bool
+	// elevate is set when files needing root can go to the clean helper
+	elevate bool
+	// compress only accepts regular files that aren't compressed yet
+	compress bool
+	scope    scanScope
+}
+
+func newCleanChecks(files []FileInfo, options CleanOptions) *cleanChecks {
+	checks := &cleanChecks{
+		rules:          cleanerRuleIndex(loadCleanerRulesOrDefault()),
+		openFiles:      buildOpenFileIndex(),
+		allowOpenFiles: options.AllowOpenFiles,
+		compress:       options.Mode == CleanModeCompress,
+		scope:          options.scope,
+	}
+
+	// Permissions are only checked if something needs them
+	for _, file := range files {
+		if file.NeedsElevation {
+			status := checkPermissions()
+			checks.permissions = &status
+			checks.elevate = options.Elevate && !status.IsElevated && status.HelperAvailable &&
+				(options.Mode == "" || options.Mode == CleanModeDelete)
+			break
+		}
+	}
+
+	return checks
+}
+
+// check applies the safety checks shared by CleanFiles and PlanCleanFiles. It reports
+// whether item must be skipped and fills in why.
+func (c *cleanChecks) check(item *CleanPlanItem) bool {
+	// Only delete what a scan actually found, where it found it
+	entry, reason, skip := verifyScannedPath(c.scope, item.File.Path)
+	if skip {
+		item.Reason = reason
+		return true
+	}
+
+	// The compressible file search offers its candidates for compression only
+	if entry.scope == scopeCompress && !c.compress {
+		item.Reason = SkipNotScanned
+		return true
+	}
+
+	// How a file is cleaned is up to the scan, not the caller: its rule decides the
+	// clean method, and only live logs it offered are truncated
+	item.File.RuleID = entry.ruleID
+	item.File.Truncate = entry.truncateOnly
+	file := item.File
+	rule := c.rules[file.RuleID]
+
+	// Live logs are still written to, directories can't be gzipped as a whole
+	if c.compress {
+		if info, err := os.Lstat(file.Path); err != nil || !info.Mode().IsRegular() || file.Truncate || compressedLogExt.MatchString(file.Path) {
+			item.Reason = SkipNotCompressible
+			return true
+		}
+	}
+
+	// Skip files that need elevation if we don't have it, unless the helper takes them
+	if file.NeedsElevation && (c.permissions == nil || !c.permissions.IsElevated) {
+		if !c.elevate {
+			item.Reason = SkipRequiresElevation
+			return true
+		}
+		item.Elevated = true
+	}
+
+	// Skip files a process still has open
+	// Live logs being truncated are expected to be open and recently written
+	if file.Truncate {
+		if !item.Elevated && !hasWritePermission(file.Path) {
+			item.Reason = SkipNoWritePermission
+			return true
+		}
+		return false
+	}
+
+	if openedBy := c.openFiles.openedBy(file.Path); len(openedBy) > 0 && !c.allowOpenFiles {
+		item.Reason, item.OpenedBy = SkipInUse, openedBy
+		return true
+	}
+
+	// Skip if the file is younger than its rule allows, or younger than a minute
+	// when open files can't be detected (safety measure)
+	ruleMinAge, _ := rule.minAge()
+	if info, err := os.Lstat(file.Path); err == nil {
+		if time.Since(info.ModTime()) < c.openFiles.ageGuard(ruleMinAge, info) {
+			item.Reason = SkipRecentlyModified
+			return true
+		}
+	}
+
+	// Skip protected paths: system critical ones and the user's exclusions, and
+	// directories holding one, since the whole directory would go
+	if protection, protected := protectionBelow(file.Path); protected {
+		item.Reason, item.ProtectedBy = protectionSkipReason(protection), protection
+		return true
+	}
+
+	// Check write permission. Read-only trees (like the Go module cache) are made
+	// writable before removal, so only their parent has to be writable.
+	// Compressing writes the .gz next to the file, so its directory must be writable.
+	writeTarget := file.Path
+	if rule.CleanMethod == CleanMethodMakeWritable || c.compress {
+		writeTarget = filepath.Dir(file.Path)
+	}
+	if !item.Elevated && !hasWritePermission(writeTarget) {
+		item.Reason = SkipNoWritePermission
+		return true
+	}
+
+	return false
+}
+
+// skipMessage formats a skip reason the way CleanFiles reports failures
+func skipMessage(reason SkipReason, path string) string {
+	switch reason {
+	case SkipRequiresElevation:
+		return fmt.Sprintf("Access denied (requires elevation): %s", path)
+	case SkipRecentlyModified:
+		return fmt.Sprintf("Skipped (recently modified): %s", path)
+	case SkipCriticalFile:
+		return fmt.Sprintf("Skipped (critical file): %s", path)
+	case SkipNoWritePermission:
+		return fmt.Sprintf("Access denied (no write permission): %s", path)
+	case SkipInvalidPath:
+		return fmt.Sprintf("Refused (invalid path): %s", path)
+	case SkipNotScanned:
+		return fmt.Sprintf("Refused (not found by a scan): %s", path)
+	case SkipOutsideScanRoot:
+		return fmt.Sprintf("Refused (outside the scanned location): %s", path)
+	case SkipFileChanged:
+		return fmt.Sprintf("Skipped (changed since scan): %s", path)
+	case SkipInUse:
+		return fmt.Sprintf("Skipped (in use by a running process): %s", path)
+	case SkipUserExcluded:
+		return fmt.Sprintf("Skipped (excluded by your protection rules): %s", path)
+	case SkipNotDuplicate:
+		return fmt.Sprintf("Skipped (not a known duplicate): %s", path)
+	case SkipLastCopy:
+		return fmt.Sprintf("Skipped (last remaining copy): %s", path)
+	case SkipDifferentGroup:
+		return fmt.Sprintf("Skipped (not a copy of the kept file): %s", path)
+	case SkipNotCompressible:
+		return fmt.Sprintf("Skipped (cannot be compressed): %s", path)
+	default:
+		return fmt.Sprintf("Skipped (%s): %s", reason, path)
+	}
+}
@@ -0,0 +1,260 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+
+	"github.com/shirou/gopsutil/v4/disk"
+)
+
+// CleanItemStatus is what happened to one item of a clean run
+type CleanItemStatus string
+
+const (
+	StatusRemoved     CleanItemStatus = "removed"
+	StatusTruncated   CleanItemStatus = "truncated"
+	StatusQuarantined CleanItemStatus = "quarantined"
+	StatusTrashed     CleanItemStatus = "trashed"
+	StatusLinked      CleanItemStatus = "linked"
+	StatusCompressed  CleanItemStatus = "compressed"
+	StatusSkipped     CleanItemStatus = "skipped"
+	StatusFailed      CleanItemStatus = "failed"
+)
+
+// CleanErrorCode classifies why an item, or the whole run, failed
+type CleanErrorCode string
+
+const (
+	ErrorPermissionDenied CleanErrorCode = "permission_denied"
+	ErrorNotFound         CleanErrorCode = "not_found"
+	ErrorBusy             CleanErrorCode = "busy"
+	ErrorReadOnly         CleanErrorCode = "read_only"
+	ErrorNoSpace          CleanErrorCode = "no_space"
+	ErrorCrossDevice      CleanErrorCode = "cross_device"
+	ErrorIO               CleanErrorCode = "io_error"
+	// ErrorElevationFailed means the privileged helper couldn't be started or stopped early
+	ErrorElevationFailed CleanErrorCode = "elevation_failed"
+	// Run-level errors
+	ErrorQuarantineFailed CleanErrorCode = "quarantine_failed"
+	ErrorAuditLogFailed   CleanErrorCode = "audit_log_failed"
+)
+
+// CleanItemResult is the outcome for a single file. Reason is set for skipped items,
+// ErrorCode and OSError for failed ones.
+type CleanItemResult struct {
+	Path        string          `json:"path"`
+	Category    string          `json:"category"`
+	Bytes       int64           `json:"bytes"`
+	Status      CleanItemStatus `json:"status"`
+	Reason      SkipReason      `json:"reason,omitempty"`
+	ErrorCode   CleanErrorCode  `json:"errorCode,omitempty"`
+	OSError     string          `json:"osError,omitempty"`
+	OpenedBy    []ProcessRef    `json:"openedBy,omitempty"`
+	ProtectedBy *ProtectionRule `json:"protectedBy,omitempty"`
+}
+
+// CleanRunError is a failure that isn't tied to a single item
+type CleanRunError struct {
+	Code    CleanErrorCode `json:"code"`
+	OSError string         `json:"osError"`
+}
+
+// CategoryTotals sums the items of one category
+type CategoryTotals struct {
+	CleanedCount int   `json:"cleanedCount"`
+	CleanedSize  int64 `json:"cleanedSize"`
+	SkippedCount int   `json:"skippedCount"`
+	FailedCount  int   `json:"failedCount"`
+}
+
+// PartitionDelta is the free space of a partition before and after a run. Freed can
+// differ from the cleaned size: quarantined files stay on disk, hardlinked files
+// still have other names, and other programs write in the meantime.
+type PartitionDelta struct {
+	Mountpoint string `json:"mountpoint"`
+	FreeBefore uint64 `json:"freeBefore"`
+	FreeAfter  uint64 `json:"freeAfter"`
+	Freed      int64  `json:"freed"`
+}
+
+// CleanReport is the outcome of a clean run
+type CleanReport struct {
+	Items             []CleanItemResult         `json:"items"`
+	Categories        map[string]CategoryTotals `json:"categories"`
+	Partitions        []PartitionDelta          `json:"partitions"`
+	CleanedCount      int                       `json:"cleanedCount"`
+	CleanedSize       int64                     `json:"cleanedSize"`
+	SkippedCount      int                       `json:"skippedCount"`
+	FailedCount       int                       `json:"failedCount"`
+	Errors            []CleanRunError           `json:"errors"`
+	QuarantineBatchID string                    `json:"quarantineBatchId,omitempty"`
+	AuditRunID        string                    `json:"auditRunId,omitempty"`
+	// HeldOpen lists the processes that still hold removed files open; that space
+	// only comes back once they close them or exit
+	HeldOpen     []DeletedFileHolder `json:"heldOpen"`
+	HeldOpenSize int64               `json:"heldOpenSize"`
+}
+
+func newCleanReport() CleanReport {
+	return CleanReport{
+		Items:      []CleanItemResult{},
+		Categories: map[string]CategoryTotals{},
+		Partitions: []PartitionDelta{},
+		Errors:     []CleanRunError{},
+		HeldOpen:   []DeletedFileHolder{},
+	}
+}
+
+func (r *CleanReport) add(item CleanItemResult) {
+	r.Items = append(r.Items, item)
+
+	totals := r.Categories[item.Category]
+	switch item.Status {
+	case StatusSkipped:
+		totals.SkippedCount++
+		r.SkippedCount++
+	case StatusFailed:
+		totals.FailedCount++
+		r.FailedCount++
+	default:
+		totals.CleanedCount++
+		totals.CleanedSize += item.Bytes
+		r.CleanedCount++
+		r.CleanedSize += item.Bytes
+	}
+	r.Categories[item.Category] = totals
+}
+
+func (r *CleanReport) cleaned(file FileInfo, status CleanItemStatus) {
+	r.add(CleanItemResult{Path: file.Path, Category: file.Location, Bytes: file.Size, Status: status})
+}
+
+func (r *CleanReport) skipped(item CleanPlanItem) {
+	r.add(CleanItemResult{
+		Path:        item.File.Path,
+		Category:    item.File.Location,
+		Bytes:       item.File.Size,
+		Status:      StatusSkipped,
+		Reason:      item.Reason,
+		OpenedBy:    item.OpenedBy,
+		ProtectedBy: item.ProtectedBy,
+	})
+}
+
+func (r *CleanReport) failed(file FileInfo, err error) {
+	r.add(CleanItemResult{
+		Path:      file.Path,
+		Category:  file.Location,
+		Bytes:     file.Size,
+		Status:    StatusFailed,
+		ErrorCode: cleanErrorCode(err),
+		OSError:   err.Error(),
+	})
+}
+
+func (r *CleanReport) runFailed(code CleanErrorCode, err error) {
+	r.Errors = append(r.Errors, CleanRunError{Code: code, OSError: err.Error()})
+}
+
+// failureMessages formats the skipped and failed items the way CleanFiles always has
+func (r *CleanReport) failureMessages() []string {
+	messages := []string{}
+	for _, runErr := range r.Errors {
+		switch runErr.Code {
+		case ErrorQuarantineFailed:
+			messages = append(messages, fmt.Sprintf("Failed to create quarantine (Error: %s)", runErr.OSError))
+		case ErrorAuditLogFailed:
+			messages = append(messages, fmt.Sprintf("Failed to write audit log (Error: %s)", runErr.OSError))
+		default:
+			messages = append(messages, fmt.Sprintf("Failed (%s): %s", runErr.Code, runErr.OSError))
+		}
+	}
+	for _, item := range r.Items {
+		switch item.Status {
+		case StatusSkipped:
+			messages = append(messages, skipMessage(item.Reason, item.Path))
+		case StatusFailed:
+			messages = append(messages, fmt.Sprintf("Failed to remove: %s (Error: %s)", item.Path, item.OSError))
+		}
+	}
+	return messages
+}
+
+// cleanErrorCode maps an error from removing, moving or truncating a file to a code
+func cleanErrorCode(err error) CleanErrorCode {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorPermissionDenied
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorNotFound
+	case errors.Is(err, syscall.EBUSY):
+		return ErrorBusy
+	case errors.Is(err, syscall.EROFS):
+		return ErrorReadOnly
+	case errors.Is(err, syscall.ENOSPC):
+		return ErrorNoSpace
+	case errors.Is(err, syscall.EXDEV), isCrossDeviceError(err):
+		return ErrorCrossDevice
+	default:
+		return ErrorIO
+	}
+}
+
+// partitionMeter remembers the free space of the partitions a run is about to touch
+type partitionMeter struct {
+	partitions []PartitionDelta
+}
+
+// measurePartitions records the free space of every partition holding one of files.
+// Files are grouped by the mount point of their folder.
+func measurePartitions(files []FileInfo) *partitionMeter {
+	meter := &partitionMeter{}
+	mountpoints := map[string]string{}
+	seen := map[string]bool{}
+
+	for _, file := range files {
+		dir := filepath.Dir(file.Path)
+		mountpoint, known := mountpoints[dir]
+		if !known {
+			info, err := os.Stat(dir)
+			if err != nil {
+				continue
+			}
+			device, _ := deviceOf(info)
+			mountpoint = mountTopdir(file.Path, device)
+			mountpoints[dir] = mountpoint
+		}
+		if seen[mountpoint] {
+			continue
+		}
+		seen[mountpoint] = true
+
+		usage, err := disk.Usage(mountpoint)
+		if err != nil {
+			continue
+		}
+		meter.partitions = append(meter.partitions, PartitionDelta{Mountpoint: mountpoint, FreeBefore: usage.Free})
+	}
+	return meter
+}
+
+// finish measures the partitions again and returns the change of each
+func (m *partitionMeter) finish() []PartitionDelta {
+	deltas := []PartitionDelta{}
+	for _, partition := range m.partitions {
+		usage, err := disk.Usage(partition.Mountpoint)
+		if err != nil {
+			continue
+		}
+		partition.FreeAfter = usage.Free
+		partition.Freed = int64(usage.Free) - int64(partition.FreeBefore)
+		deltas = append(deltas, partition)
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Mountpoint < deltas[j].Mountpoint })
+	return deltas
+}
@@ -0,0 +1,54 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCleanReport(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	path := writeScannedFile(t, root, "old.tmp", make([]byte, 64)).Path
+
+	unscanned := filepath.Join(root, "unscanned.tmp")
+	report := CleanFilesWithOptions([]FileInfo{
+		{Path: path, Size: 64, Location: "Temp"},
+		{Path: unscanned, Size: 8, Location: "Temp"},
+	}, CleanOptions{})
+
+	if len(report.Items) != 2 || report.CleanedCount != 1 || report.SkippedCount != 1 {
+		t.Fatalf("Expected one removed and one skipped item, got: %+v", report)
+	}
+	if item := report.Items[0]; item.Status != StatusRemoved || item.Bytes != 64 || item.Category != "Temp" {
+		t.Errorf("Expected the scanned file to be removed, got: %+v", item)
+	}
+	if item := report.Items[1]; item.Status != StatusSkipped || item.Reason != SkipNotScanned {
+		t.Errorf("Expected the unscanned file to be skipped, got: %+v", item)
+	}
+	if totals := report.Categories["Temp"]; totals.CleanedSize != 64 || totals.SkippedCount != 1 {
+		t.Errorf("Unexpected category totals: %+v", totals)
+	}
+	if len(report.Partitions) != 1 {
+		t.Errorf("Expected the partition of %s to be measured, got: %+v", root, report.Partitions)
+	}
+
+	messages := report.failureMessages()
+	if len(messages) != 1 || messages[0] != skipMessage(SkipNotScanned, unscanned) {
+		t.Errorf("Unexpected legacy failure messages: %v", messages)
+	}
+
+	cases := map[error]CleanErrorCode{
+		&os.PathError{Op: "remove", Path: path, Err: syscall.EACCES}: ErrorPermissionDenied,
+		&os.PathError{Op: "remove", Path: path, Err: syscall.ENOENT}: ErrorNotFound,
+		&os.PathError{Op: "remove", Path: path, Err: syscall.EROFS}:  ErrorReadOnly,
+		&os.LinkError{Op: "rename", Err: syscall.EXDEV}:              ErrorCrossDevice,
+	}
+	for err, want := range cases {
+		if got := cleanErrorCode(err); got != want {
+			t.Errorf("cleanErrorCode(%v) = %s, want %s", err, got, want)
+		}
+	}
+}
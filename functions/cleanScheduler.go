@@ -0,0 +1,511 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/disk"
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	cleanJobsFile     = "clean-jobs.json"
+	cleanJobStateFile = "clean-jobs-state.json"
+	// cleanJobLockFile is locked while a job runs, by the app and the headless runner alike
+	cleanJobLockFile = "clean-jobs.lock"
+
+	// schedulerTick is how often the scheduler checks for due jobs
+	schedulerTick = time.Minute
+	// freeSpaceCooldown keeps a free space trigger from firing over and over while
+	// the disk stays full
+	freeSpaceCooldown = time.Hour
+	minJobInterval    = time.Minute
+)
+
+// CleanJob is an unattended clean: what to clean and when. A job with no schedule,
+// interval or free space trigger only runs when started by hand.
+type CleanJob struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+
+	// Categories limits the job to these cleaner categories; empty means all of them
+	Categories []string `json:"categories"`
+	// MinAge skips entries modified more recently than this, e.g. "168h"
+	MinAge string    `json:"minAge,omitempty"`
+	Mode   CleanMode `json:"mode,omitempty"`
+	// IncludeSystem also cleans locations that need elevation (for headless runs as
+	// root); otherwise only what SafeClean finds is cleaned
+	IncludeSystem bool `json:"includeSystem,omitempty"`
+
+	// Schedule is a five-field cron expression
+	Schedule string `json:"schedule,omitempty"`
+	// Interval runs the job this long after its last run, e.g. "24h"
+	Interval string `json:"interval,omitempty"`
+	// FreeSpaceBelow runs the job when FreeSpacePath has less than this percentage free
+	FreeSpaceBelow float64 `json:"freeSpaceBelowPercent,omitempty"`
+	FreeSpacePath  string  `json:"freeSpacePath,omitempty"`
+}
+
+// CleanJobRun is the outcome of one run of a job
+type CleanJobRun struct {
+	JobID     string      `json:"jobId"`
+	JobName   string      `json:"jobName"`
+	Trigger   string      `json:"trigger"`
+	StartedAt time.Time   `json:"startedAt"`
+	Summary   CleanReport `json:"summary"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// cleanJobState is what the scheduler remembers about a job between runs
+type cleanJobState struct {
+	LastRun    time.Time    `json:"lastRun"`
+	LastResult *CleanJobRun `json:"lastResult,omitempty"`
+}
+
+var (
+	// cleanJobsMu serializes changes to the job definitions
+	cleanJobsMu sync.Mutex
+
+	// ErrCleanJobRunning is returned when a job is started while another one runs,
+	// in this process or another
+	ErrCleanJobRunning = errors.New("another cleaning job is running")
+	errLockHeld        = errors.New("lock is held")
+
+	// cleanJobScan finds what a job can clean; tests replace it to skip the real scan
+	cleanJobScan = func(ctx context.Context, includeSystem bool) (CleanerResult, error) {
+		if includeSystem {
+			return GetCleanableFilesContext(ctx, nil)
+		}
+		return SafeCleanContext(ctx, nil)
+	}
+)
+
+// LoadCleanJobs returns the saved job definitions
+func LoadCleanJobs() ([]CleanJob, error) {
+	jobs := []CleanJob{}
+
+	path, err := CleanJobsPath()
+	if err != nil {
+		return jobs, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return jobs, nil
+	}
+	if err != nil {
+		return jobs, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var file struct {
+		Jobs []CleanJob `json:"jobs"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return jobs, fmt.Errorf("error decoding %s: %w", path, err)
+	}
+	if file.Jobs != nil {
+		jobs = file.Jobs
+	}
+	return jobs, nil
+}
+
+// SaveCleanJob adds a job, or replaces the one with the same ID. A job without an ID
+// gets a new one.
+func SaveCleanJob(job CleanJob) (CleanJob, error) {
+	if job.ID == "" {
+		job.ID = fmt.Sprintf("job-%d", time.Now().UnixNano())
+	}
+	if err := job.validate(); err != nil {
+		return job, err
+	}
+
+	cleanJobsMu.Lock()
+	defer cleanJobsMu.Unlock()
+
+	jobs, err := LoadCleanJobs()
+	if err != nil {
+		return job, err
+	}
+
+	replaced := false
+	for i := range jobs {
+		if jobs[i].ID == job.ID {
+			jobs[i] = job
+			replaced = true
+		}
+	}
+	if !replaced {
+		jobs = append(jobs, job)
+	}
+
+	return job, writeCleanJobs(jobs)
+}
+
+// DeleteCleanJob removes a job definition
+func DeleteCleanJob(id string) error {
+	cleanJobsMu.Lock()
+	defer cleanJobsMu.Unlock()
+
+	jobs, err := LoadCleanJobs()
+	if err != nil {
+		return err
+	}
+
+	kept := []CleanJob{}
+	for _, job := range jobs {
+		if job.ID != id {
+			kept = append(kept, job)
+		}
+	}
+	if len(kept) == len(jobs) {
+		return fmt.Errorf("no clean job with id %q", id)
+	}
+	return writeCleanJobs(kept)
+}
+
+func writeCleanJobs(jobs []CleanJob) error {
+	path, err := CleanJobsPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(map[string][]CleanJob{"jobs": jobs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// CleanJobsPath returns where the job definitions are stored
+func CleanJobsPath() (string, error) {
+	dir, err := appConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cleanJobsFile), nil
+}
+
+func (j CleanJob) validate() error {
+	if j.Schedule != "" {
+		schedule, err := parseCronSchedule(j.Schedule)
+		if err != nil {
+			return err
+		}
+		if schedule.next(time.Now()).IsZero() {
+			return fmt.Errorf("cron expression %q never fires", j.Schedule)
+		}
+	}
+	if j.Interval != "" {
+		interval, err := time.ParseDuration(j.Interval)
+		if err != nil {
+			return fmt.Errorf("bad interval %q: %w", j.Interval, err)
+		}
+		if interval < minJobInterval {
+			return fmt.Errorf("interval %s is shorter than %s", interval, minJobInterval)
+		}
+	}
+	if j.MinAge != "" {
+		if _, err := time.ParseDuration(j.MinAge); err != nil {
+			return fmt.Errorf("bad minAge %q: %w", j.MinAge, err)
+		}
+	}
+	if j.FreeSpaceBelow < 0 || j.FreeSpaceBelow >= 100 {
+		return fmt.Errorf("free space threshold %.1f%% must be between 0 and 100", j.FreeSpaceBelow)
+	}
+	switch j.Mode {
+	case "", CleanModeDelete, CleanModeQuarantine, CleanModeTrash:
+	default:
+		return fmt.Errorf("unknown clean mode %q", j.Mode)
+	}
+	return nil
+}
+
+// dueTrigger returns what makes the job due at now, or "" when it isn't
+func (j CleanJob) dueTrigger(state cleanJobState, now time.Time) string {
+	if !j.Enabled {
+		return ""
+	}
+
+	if j.Schedule != "" {
+		if schedule, err := parseCronSchedule(j.Schedule); err == nil {
+			// A job that never ran starts with the current tick rather than catching up
+			since := state.LastRun
+			if since.IsZero() {
+				since = now.Add(-schedulerTick)
+			}
+			if next := schedule.next(since); !next.IsZero() && !next.After(now) {
+				return "schedule"
+			}
+		}
+	}
+
+	if j.Interval != "" {
+		if interval, err := time.ParseDuration(j.Interval); err == nil && !now.Before(state.LastRun.Add(interval)) {
+			return "interval"
+		}
+	}
+
+	if j.FreeSpaceBelow > 0 && now.Sub(state.LastRun) >= freeSpaceCooldown {
+		if free, err := freeSpacePercent(j.freeSpacePath()); err == nil && free < j.FreeSpaceBelow {
+			return fmt.Sprintf("free space %.1f%% below %.1f%%", free, j.FreeSpaceBelow)
+		}
+	}
+
+	return ""
+}
+
+func (j CleanJob) freeSpacePath() string {
+	if j.FreeSpacePath != "" {
+		return j.FreeSpacePath
+	}
+	if runtime.GOOS == "windows" {
+		if drive := os.Getenv("SystemDrive"); drive != "" {
+			return drive + `\`
+		}
+		return `C:\`
+	}
+	return "/"
+}
+
+func freeSpacePercent(path string) (float64, error) {
+	usage, err := disk.Usage(path)
+	if err != nil {
+		return 0, err
+	}
+	return 100 - usage.UsedPercent, nil
+}
+
+// acquireCleanJobLock locks the job lock file, returning ErrCleanJobRunning when a
+// job is already running. The returned function releases the lock.
+func acquireCleanJobLock() (func(), error) {
+	dir, err := appConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, cleanJobLockFile)
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	if err := tryLockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLockHeld) {
+			return nil, ErrCleanJobRunning
+		}
+		return nil, fmt.Errorf("error locking %s: %w", path, err)
+	}
+	return func() { f.Close() }, nil
+}
+
+// RunCleanJob runs a job now, whatever its triggers say
+func RunCleanJob(ctx context.Context, id string) (CleanJobRun, error) {
+	jobs, err := LoadCleanJobs()
+	if err != nil {
+		return CleanJobRun{}, err
+	}
+	for _, job := range jobs {
+		if job.ID != id {
+			continue
+		}
+		release, err := acquireCleanJobLock()
+		if err != nil {
+			return CleanJobRun{}, err
+		}
+		defer release()
+		return runCleanJob(ctx, job, "manual"), nil
+	}
+	return CleanJobRun{}, fmt.Errorf("no clean job with id %q", id)
+}
+
+// RunDueCleanJobs runs every enabled job that is due and returns their results. When
+// another job is running it runs nothing; the due jobs are picked up next time.
+func RunDueCleanJobs(ctx context.Context) ([]CleanJobRun, error) {
+	jobs, err := LoadCleanJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []CleanJobRun{}
+	release, err := acquireCleanJobLock()
+	if errors.Is(err, ErrCleanJobRunning) {
+		return runs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		states := loadCleanJobStates()
+		if trigger := job.dueTrigger(states[job.ID], time.Now()); trigger != "" {
+			runs = append(runs, runCleanJob(ctx, job, trigger))
+		}
+	}
+	return runs, ctx.Err()
+}
+
+// StartCleanScheduler checks for due jobs every minute while ctx is alive and emits
+// a "clean-job-run" event and a notification for each run
+func StartCleanScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerTick)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runs, _ := RunDueCleanJobs(ctx)
+				for _, run := range runs {
+					EmitCleanJobRun(ctx, run)
+				}
+			}
+		}
+	}()
+}
+
+// EmitCleanJobRun tells the frontend about a finished run
+func EmitCleanJobRun(ctx context.Context, run CleanJobRun) {
+	wailsRuntime.EventsEmit(ctx, "clean-job-run", run)
+	wailsRuntime.EventsEmit(ctx, "notification", map[string]string{
+		"title":   run.Title(),
+		"message": run.Describe(),
+	})
+}
+
+// NotifyCleanJobRun shows a finished run as a desktop notification, for runs made
+// without the app's window, like those of the headless runner
+func NotifyCleanJobRun(run CleanJobRun) error {
+	return sendDesktopNotification(run.Title(), run.Describe())
+}
+
+// Title names a finished run in notifications
+func (r CleanJobRun) Title() string {
+	return fmt.Sprintf("Cleaning job %q finished", r.JobName)
+}
+
+// Describe summarizes a run in one line
+func (r CleanJobRun) Describe() string {
+	if r.Error != "" {
+		return fmt.Sprintf("Failed: %s", r.Error)
+	}
+	return fmt.Sprintf("Cleaned %d items (%s), %d skipped or failed",
+		r.Summary.CleanedCount, GetFormattedSize(r.Summary.CleanedSize), r.Summary.SkippedCount+r.Summary.FailedCount)
+}
+
+// runCleanJob scans, selects the job's categories and cleans them through CleanFiles.
+// The caller holds the job lock.
+func runCleanJob(ctx context.Context, job CleanJob, trigger string) CleanJobRun {
+	run := CleanJobRun{
+		JobID:     job.ID,
+		JobName:   job.Name,
+		Trigger:   trigger,
+		StartedAt: time.Now(),
+		Summary:   newCleanReport(),
+	}
+
+	result, err := cleanJobScan(ctx, job.IncludeSystem)
+	if err != nil {
+		run.Error = err.Error()
+	} else {
+		run.Summary = CleanFilesWithOptions(job.selectFiles(result), CleanOptions{Mode: job.Mode})
+	}
+
+	states := loadCleanJobStates()
+	states[job.ID] = cleanJobState{LastRun: run.StartedAt, LastResult: &run}
+	if err := writeCleanJobStates(states); err != nil && run.Error == "" {
+		run.Error = fmt.Sprintf("error saving job state: %s", err)
+	}
+
+	return run
+}
+
+// selectFiles picks the scanned entries in the job's categories that are old enough
+func (j CleanJob) selectFiles(result CleanerResult) []FileInfo {
+	minAge, _ := time.ParseDuration(j.MinAge)
+
+	categories := map[string]bool{}
+	for _, category := range j.Categories {
+		categories[category] = true
+	}
+
+	var files []FileInfo
+	for category, categoryFiles := range result.Files {
+		if len(categories) > 0 && !categories[category] {
+			continue
+		}
+		for _, file := range categoryFiles {
+			if minAge > 0 {
+				info, err := os.Lstat(file.Path)
+				if err != nil || time.Since(info.ModTime()) < minAge {
+					continue
+				}
+			}
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// GetCleanJobResults returns the last run of each job, keyed by job ID
+func GetCleanJobResults() map[string]CleanJobRun {
+	results := map[string]CleanJobRun{}
+	for id, state := range loadCleanJobStates() {
+		if state.LastResult != nil {
+			results[id] = *state.LastResult
+		}
+	}
+	return results
+}
+
+func cleanJobStatePath() (string, error) {
+	dir, err := appDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cleanJobStateFile), nil
+}
+
+// loadCleanJobStates never fails: missing or broken state just means no job has run yet
+func loadCleanJobStates() map[string]cleanJobState {
+	states := map[string]cleanJobState{}
+
+	path, err := cleanJobStatePath()
+	if err != nil {
+		return states
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &states)
+	}
+	return states
+}
+
+func writeCleanJobStates(states map[string]cleanJobState) error {
+	path, err := cleanJobStatePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
@@ -0,0 +1,146 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTempJobDirs keeps the job definitions, state and lock in temporary directories
+func useTempJobDirs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("APPDATA", filepath.Join(home, "config"))
+	useTempAppData(t)
+}
+
+func TestCleanJobValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		job   CleanJob
+		valid bool
+	}{
+		{"empty", CleanJob{}, true},
+		{"schedule", CleanJob{Schedule: "0 3 * * *"}, true},
+		{"leap day", CleanJob{Schedule: "0 0 29 2 *"}, true},
+		{"never fires", CleanJob{Schedule: "0 0 30 2 *"}, false},
+		{"bad schedule", CleanJob{Schedule: "0 3 * *"}, false},
+		{"interval", CleanJob{Interval: "24h"}, true},
+		{"short interval", CleanJob{Interval: "30s"}, false},
+		{"bad interval", CleanJob{Interval: "daily"}, false},
+		{"bad minAge", CleanJob{MinAge: "week"}, false},
+		{"free space", CleanJob{FreeSpaceBelow: 10}, true},
+		{"free space out of range", CleanJob{FreeSpaceBelow: 100}, false},
+		{"quarantine", CleanJob{Mode: CleanModeQuarantine}, true},
+		{"unknown mode", CleanJob{Mode: "shred"}, false},
+	}
+	for _, c := range cases {
+		if err := c.job.validate(); (err == nil) != c.valid {
+			t.Errorf("%s: got %v, want valid=%v", c.name, err, c.valid)
+		}
+	}
+}
+
+func TestCleanJobDueTrigger(t *testing.T) {
+	now := time.Date(2024, time.January, 31, 3, 0, 20, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		job     CleanJob
+		lastRun time.Time
+		want    string
+	}{
+		{"disabled", CleanJob{Schedule: "* * * * *"}, time.Time{}, ""},
+		{"no trigger", CleanJob{Enabled: true}, time.Time{}, ""},
+		{"schedule never ran", CleanJob{Enabled: true, Schedule: "0 3 * * *"}, time.Time{}, "schedule"},
+		{"schedule missed", CleanJob{Enabled: true, Schedule: "0 2 * * *"}, now.Add(-2 * time.Hour), "schedule"},
+		{"schedule ran", CleanJob{Enabled: true, Schedule: "0 3 * * *"}, now, ""},
+		{"schedule not yet", CleanJob{Enabled: true, Schedule: "0 4 * * *"}, now.Add(-time.Hour), ""},
+		{"interval due", CleanJob{Enabled: true, Interval: "1h"}, now.Add(-time.Hour), "interval"},
+		{"interval not yet", CleanJob{Enabled: true, Interval: "1h"}, now.Add(-time.Minute), ""},
+	}
+	for _, c := range cases {
+		if got := c.job.dueTrigger(cleanJobState{LastRun: c.lastRun}, now); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRunDueCleanJobs(t *testing.T) {
+	useTempJobDirs(t)
+
+	root := t.TempDir()
+	cache := writeScannedFile(t, root, "cache.bin", []byte("data"))
+	logs := writeScannedFile(t, root, "app.log", []byte("data"))
+
+	scans := 0
+	original := cleanJobScan
+	cleanJobScan = func(context.Context, bool) (CleanerResult, error) {
+		scans++
+		return CleanerResult{Files: map[string][]FileInfo{"Cache": {cache}, "Logs": {logs}}}, nil
+	}
+	t.Cleanup(func() { cleanJobScan = original })
+
+	job, err := SaveCleanJob(CleanJob{Name: "caches", Enabled: true, Categories: []string{"Cache"}, Interval: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := RunDueCleanJobs(context.Background())
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("Expected one run, got %+v (%v)", runs, err)
+	}
+	if run := runs[0]; run.JobID != job.ID || run.Trigger != "interval" || run.Error != "" || run.Summary.CleanedCount != 1 {
+		t.Errorf("Expected the job to clean cache.bin, got: %+v", run)
+	}
+	if _, err := os.Lstat(cache.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected cache.bin to be cleaned, got %v", err)
+	}
+	if _, err := os.Lstat(logs.Path); err != nil {
+		t.Errorf("Expected app.log outside the job's categories to stay: %v", err)
+	}
+	if _, saved := GetCleanJobResults()[job.ID]; !saved {
+		t.Error("Expected the run to be saved")
+	}
+
+	// The interval starts again from the run just made
+	if runs, err := RunDueCleanJobs(context.Background()); err != nil || len(runs) != 0 || scans != 1 {
+		t.Errorf("Expected nothing due right after the run, got %+v (%v)", runs, err)
+	}
+}
+
+func TestCleanJobLock(t *testing.T) {
+	useTempJobDirs(t)
+
+	original := cleanJobScan
+	cleanJobScan = func(context.Context, bool) (CleanerResult, error) { return CleanerResult{}, nil }
+	t.Cleanup(func() { cleanJobScan = original })
+
+	job, err := SaveCleanJob(CleanJob{Name: "due", Enabled: true, Interval: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := acquireCleanJobLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquireCleanJobLock(); !errors.Is(err, ErrCleanJobRunning) {
+		t.Errorf("Expected the lock to be taken, got %v", err)
+	}
+	if _, err := RunCleanJob(context.Background(), job.ID); !errors.Is(err, ErrCleanJobRunning) {
+		t.Errorf("Expected a manual run to be refused while locked, got %v", err)
+	}
+	if runs, err := RunDueCleanJobs(context.Background()); err != nil || len(runs) != 0 {
+		t.Errorf("Expected due jobs to wait while locked, got %+v (%v)", runs, err)
+	}
+
+	release()
+	if runs, err := RunDueCleanJobs(context.Background()); err != nil || len(runs) != 1 {
+		t.Errorf("Expected the due job to run once unlocked, got %+v (%v)", runs, err)
+	}
+}
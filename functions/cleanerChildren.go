@@ -0,0 +1,187 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultChildrenPageSize = 100
+
+// EntryPage selects a page of a listing
+type EntryPage struct {
+	Offset int `json:"offset"`
+	// Limit is the page size, 100 if zero
+	Limit int `json:"limit"`
+}
+
+// CleanableChild is an entry inside a cleanable directory. Reason is set when it
+// can't be cleaned on its own, like the skipped entries of a scan.
+type CleanableChild struct {
+	File        FileInfo        `json:"file"`
+	IsDir       bool            `json:"isDir"`
+	Reason      SkipReason      `json:"reason,omitempty"`
+	OpenedBy    []ProcessRef    `json:"openedBy,omitempty"`
+	ProtectedBy *ProtectionRule `json:"protectedBy,omitempty"`
+}
+
+// CleanableChildren is one page of the children of a cleanable directory, biggest first
+type CleanableChildren struct {
+	Parent   FileInfo         `json:"parent"`
+	Children []CleanableChild `json:"children"`
+	Offset   int              `json:"offset"`
+	// Total and TotalSize cover all children, not just this page
+	Total     int   `json:"total"`
+	TotalSize int64 `json:"totalSize"`
+}
+
+// GetCleanableChildren lists the children of a directory found by a cleaner scan (or
+// of one of its children), so that parts of it can be cleaned. Children carry the
+// parent's category and rule and can be passed to CleanFiles like scanned entries.
+func GetCleanableChildren(parent FileInfo, page EntryPage) (*CleanableChildren, error) {
+	scanned, reason, skip := verifyScannedPath(scopeCleaner, parent.Path)
+	if skip {
+		return nil, fmt.Errorf("%s can't be listed: %s", parent.Path, reason)
+	}
+
+	info, err := os.Lstat(parent.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("only directories have children")
+	}
+	device, deviceKnown := deviceOf(info)
+
+	entries, err := os.ReadDir(parent.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", parent.Path, err)
+	}
+
+	rule := cleanerRuleIndex(loadCleanerRulesOrDefault())[scanned.ruleID]
+	ruleMinAge, _ := rule.minAge()
+
+	scanner := newCleanerScanner(context.Background(), nil)
+	scanner.openFiles = buildOpenFileIndex()
+	scanner.cache = openScanCache(false)
+	defer scanner.cache.save()
+
+	results := make([]*CleanableChild, len(entries))
+	var wg sync.WaitGroup
+
+	for i, entry := range entries {
+		fullPath := filepath.Join(parent.Path, entry.Name())
+
+		scanner.workers <- struct{}{}
+		wg.Add(1)
+		go func(i int, name, fullPath string) {
+			defer wg.Done()
+			defer func() { <-scanner.workers }()
+
+			info, err := os.Lstat(fullPath)
+			if err != nil || !sameDevice(info, device, deviceKnown) {
+				return
+			}
+
+			child := CleanableChild{
+				File: FileInfo{
+					Path:           fullPath,
+					Size:           info.Size(),
+					Name:           name,
+					Location:       parent.Location,
+					Profile:        parent.Profile,
+					NeedsElevation: parent.NeedsElevation,
+					RuleID:         scanned.ruleID,
+				},
+				IsDir: info.IsDir(),
+			}
+			if child.IsDir {
+				child.File.Size = scanner.dirSize(fullPath, device, deviceKnown)
+			}
+
+			// Protected entries are shown but never offered
+			if protection, protected := protectionFor(fullPath); protected {
+				child.Reason, child.ProtectedBy = protectionSkipReason(protection), protection
+				results[i] = &child
+				return
+			}
+
+			child.File.FileID = registerScopedFile(scopeCleaner, scanned.root, scanned.ruleID, fullPath, info)
+			if time.Since(info.ModTime()) < scanner.openFiles.ageGuard(ruleMinAge, info) {
+				child.Reason = SkipRecentlyModified
+			} else if openedBy := scanner.openFiles.openedBy(fullPath); len(openedBy) > 0 {
+				child.Reason, child.OpenedBy = SkipInUse, openedBy
+			}
+			results[i] = &child
+		}(i, entry.Name(), fullPath)
+	}
+	wg.Wait()
+
+	listing := &CleanableChildren{Parent: parent, Children: []CleanableChild{}, Offset: page.Offset}
+	var children []CleanableChild
+	for _, child := range results {
+		if child != nil {
+			children = append(children, *child)
+			listing.TotalSize += child.File.Size
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].File.Size != children[j].File.Size {
+			return children[i].File.Size > children[j].File.Size
+		}
+		return children[i].File.Name < children[j].File.Name
+	})
+	listing.Total = len(children)
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = defaultChildrenPageSize
+	}
+	if page.Offset >= 0 && page.Offset < len(children) {
+		end := min(page.Offset+limit, len(children))
+		listing.Children = children[page.Offset:end]
+	}
+	return listing, nil
+}
+
+// dropNestedItems removes the items below another item that is going to be removed:
+// the parent's size already counts them and they go with it. Items below a skipped
+// parent are kept so they can still be cleaned on their own.
+func dropNestedItems(plan *CleanPlan) {
+	removing := map[string]bool{}
+	for _, item := range plan.Items {
+		if item.Action == ActionRemove && !item.File.Truncate {
+			removing[item.File.Path] = true
+		}
+	}
+
+	items := plan.Items[:0]
+	seen := map[string]bool{}
+	for _, item := range plan.Items {
+		if item.Action == ActionRemove {
+			if seen[item.File.Path] || hasRemovedAncestor(item.File.Path, removing) {
+				plan.CategorySizes[item.File.Location] -= item.File.Size
+				plan.TotalSize -= item.File.Size
+				plan.RemoveCount--
+				continue
+			}
+			seen[item.File.Path] = true
+		}
+		items = append(items, item)
+	}
+	plan.Items = items
+}
+
+func hasRemovedAncestor(path string, removing map[string]bool) bool {
+	for dir := filepath.Dir(path); dir != path; path, dir = dir, filepath.Dir(dir) {
+		if removing[dir] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetCleanableChildren(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	write := func(rel string, size int) {
+		writeTestFile(t, filepath.Join(app, filepath.FromSlash(rel)), make([]byte, size))
+	}
+	write("blobs/a", 3000)
+	write("blobs/b", 1000)
+	write("index", 500)
+	write("small", 10)
+
+	for _, rel := range []string{"blobs/a", "blobs/b", "blobs", "index", "small", "."} {
+		backdate(t, filepath.Join(app, filepath.FromSlash(rel)))
+	}
+	info, err := os.Lstat(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := FileInfo{Path: app, Size: 4510, Name: "app", Location: "Test Cache", FileID: registerScannedFile(DirInfo{Path: root}, app, info)}
+
+	listing, err := GetCleanableChildren(parent, EntryPage{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listing.Total != 3 || listing.TotalSize != 4510 || len(listing.Children) != 2 {
+		t.Fatalf("Expected the first 2 of 3 children totalling 4510 bytes, got: %+v", listing)
+	}
+	blobs, index := listing.Children[0], listing.Children[1]
+	if blobs.File.Name != "blobs" || !blobs.IsDir || blobs.File.Size != 4000 || index.File.Name != "index" {
+		t.Errorf("Expected blobs then index, got: %+v", listing.Children)
+	}
+	if blobs.File.Location != "Test Cache" || blobs.File.FileID == "" || blobs.Reason != "" {
+		t.Errorf("Expected blobs to be cleanable like its parent, got: %+v", blobs)
+	}
+
+	listing, err = GetCleanableChildren(parent, EntryPage{Offset: 2, Limit: 2})
+	if err != nil || len(listing.Children) != 1 || listing.Children[0].File.Name != "small" {
+		t.Fatalf("Expected the last page to hold small, got: %+v (%v)", listing, err)
+	}
+
+	nested, err := GetCleanableChildren(blobs.File, EntryPage{})
+	if err != nil || nested.Total != 2 {
+		t.Fatalf("Expected to drill into blobs, got: %+v (%v)", nested, err)
+	}
+
+	if _, err := GetCleanableChildren(FileInfo{Path: filepath.Join(root, "elsewhere")}, EntryPage{}); err == nil {
+		t.Errorf("Expected an unscanned path to be refused")
+	}
+
+	// The parent and its children are selected together: the children aren't counted twice
+	selection := []FileInfo{nested.Children[0].File, parent, blobs.File, parent}
+	plan := PlanCleanFiles(selection, CleanOptions{})
+	if plan.RemoveCount != 1 || plan.TotalSize != 4510 || len(plan.Items) != 1 {
+		t.Fatalf("Expected only the parent to be planned, got: %+v", plan)
+	}
+
+	// Without the parent, a child and a grandchild below it go as one
+	report := CleanFilesWithOptions([]FileInfo{nested.Children[1].File, blobs.File, index.File}, CleanOptions{})
+	if report.CleanedCount != 2 || report.CleanedSize != 4500 {
+		t.Fatalf("Expected blobs and index to be cleaned for 4500 bytes, got: %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(app, "small")); err != nil {
+		t.Errorf("Expected small to be left alone: %v", err)
+	}
+}
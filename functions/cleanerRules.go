@@ -0,0 +1,444 @@
+package functions
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultCleanerRules is shipped with the app; users can override it with cleaner-rules.json
+//
+//go:embed cleanerRules.json
+var defaultCleanerRules []byte
+
+const userCleanerRulesFile = "cleaner-rules.json"
+
+// defaultMinAge treats recently modified files as in use when open files can't be detected
+const defaultMinAge = 1 * time.Minute
+
+// CleanerRule describes one cleanable location
+type CleanerRule struct {
+	ID                string   `json:"id"`
+	Category          string   `json:"category"`
+	Paths             []string `json:"paths"`
+	OS                []string `json:"os,omitempty"`
+	MinAge            string   `json:"minAge,omitempty"`
+	Include           []string `json:"include,omitempty"`
+	Exclude           []string `json:"exclude,omitempty"`
+	RequiresElevation bool     `json:"requiresElevation,omitempty"`
+	Disabled          bool     `json:"disabled,omitempty"`
+
+	// Provider names a built-in resolver for locations that depend on a tool's
+	// own configuration; its paths are scanned in addition to Paths
+	Provider string `json:"provider,omitempty"`
+	// CleanMethod selects how entries are removed; empty means a plain delete
+	CleanMethod string `json:"cleanMethod,omitempty"`
+
+	// KeepRotations is how many of the newest rotations of each log are kept
+	KeepRotations int `json:"keepRotations,omitempty"`
+	// TruncateOver offers live logs larger than this (e.g. "500MB") for truncation
+	TruncateOver string `json:"truncateOver,omitempty"`
+	// KeepVersions is how many of the newest versions of each cached package are kept
+	KeepVersions int `json:"keepVersions,omitempty"`
+}
+
+const (
+	// CleanMethodMakeWritable restores write permission on a tree before deleting it
+	CleanMethodMakeWritable = "make-writable"
+	// CleanMethodTrashEntry also deletes the .trashinfo of an entry in a Trash files/ dir
+	CleanMethodTrashEntry = "trash-entry"
+)
+
+// rulePathProviders resolve rule locations that can't be written as path templates
+var rulePathProviders = map[string]func() []string{
+	"go-build-cache":   goBuildCacheDirs,
+	"go-module-cache":  goModuleCacheDirs,
+	"npm-cache":        npmCacheDirs,
+	"yarn-cache":       yarnCacheDirs,
+	"pnpm-store":       pnpmStoreDirs,
+	"pip-cache":        pipCacheDirs,
+	"cargo-cache":      cargoCacheDirs,
+	"maven-repository": mavenRepositoryDirs,
+	"gradle-cache":     gradleCacheDirs,
+	"xdg-trash":        trashDirs,
+	"rotated-logs":     systemLogDirs,
+	"systemd-journal":  journalDirs,
+	"xdg-thumbnails":   thumbnailDirs,
+	"pacman-cache":     pacmanCacheDirs,
+	"slack-cache":      slackApp.cacheDirs,
+	"discord-cache":    discordApp.cacheDirs,
+	"teams-cache":      teamsApp.cacheDirs,
+	"code-cache":       codeCacheDirs,
+	"code-storage":     codeStorageDirs,
+}
+
+// ruleDir is a location resolved for a rule; Profile names the browser profile it belongs to
+type ruleDir struct {
+	Path    string
+	Profile string
+}
+
+// ruleProfileProviders resolve browser caches, one set of directories per profile
+var ruleProfileProviders = map[string]func() []ruleDir{
+	"chrome-profiles":   chromeDirs.cacheDirs,
+	"chromium-profiles": chromiumDirs.cacheDirs,
+	"edge-profiles":     edgeDirs.cacheDirs,
+	"brave-profiles":    braveDirs.cacheDirs,
+	"vivaldi-profiles":  vivaldiDirs.cacheDirs,
+	"firefox-profiles":  firefoxCacheDirs,
+}
+
+// ruleEntryScanners replace the top-level listing of a rule's directories for
+// providers that pick individual files out of a tree
+var ruleEntryScanners = map[string]func(*cleanerScanner, DirInfo) ([]FileInfo, int64){
+	"rotated-logs":    (*cleanerScanner).scanRotatedLogs,
+	"systemd-journal": (*cleanerScanner).scanJournal,
+	"xdg-thumbnails":  (*cleanerScanner).scanThumbnails,
+	"pacman-cache":    (*cleanerScanner).scanPacmanCache,
+	"code-storage":    (*cleanerScanner).scanCodeStorage,
+}
+
+// ruleEntryDetails add provider-specific details to the entries a scan finds
+var ruleEntryDetails = map[string]func(*FileInfo){
+	"xdg-trash": describeTrashEntry,
+}
+
+// CleanerRuleSet is the content of a rules file
+type CleanerRuleSet struct {
+	Version int           `json:"version"`
+	Rules   []CleanerRule `json:"rules"`
+}
+
+// LoadCleanerRules returns the built-in rules merged with the user's overrides.
+// A user rule with the same ID as a built-in one replaces it; "disabled" turns it off.
+// On error the built-in rules are still returned.
+func LoadCleanerRules() (CleanerRuleSet, error) {
+	rules, err := builtInCleanerRules()
+	if err != nil {
+		return rules, err
+	}
+
+	path, err := CleanerRulesPath()
+	if err != nil {
+		return rules, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rules, nil
+	}
+	if err != nil {
+		return rules, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var overrides CleanerRuleSet
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return rules, fmt.Errorf("error decoding %s: %w", path, err)
+	}
+
+	for _, override := range overrides.Rules {
+		if err := override.validate(); err != nil {
+			return rules, fmt.Errorf("invalid rule in %s: %w", path, err)
+		}
+	}
+
+	return mergeCleanerRules(rules, overrides), nil
+}
+
+// builtInCleanerRules returns the rules shipped with the app, without the user's overrides
+func builtInCleanerRules() (CleanerRuleSet, error) {
+	var rules CleanerRuleSet
+	if err := json.Unmarshal(defaultCleanerRules, &rules); err != nil {
+		return rules, fmt.Errorf("error decoding built-in cleaner rules: %w", err)
+	}
+	return rules, nil
+}
+
+// CleanerRulesPath returns where the user's rule overrides are read from
+func CleanerRulesPath() (string, error) {
+	dir, err := appConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, userCleanerRulesFile), nil
+}
+
+func mergeCleanerRules(base, overrides CleanerRuleSet) CleanerRuleSet {
+	merged := CleanerRuleSet{Version: base.Version}
+
+	index := map[string]int{}
+	for _, rule := range base.Rules {
+		index[rule.ID] = len(merged.Rules)
+		merged.Rules = append(merged.Rules, rule)
+	}
+
+	for _, rule := range overrides.Rules {
+		if i, exists := index[rule.ID]; exists {
+			merged.Rules[i] = rule
+			continue
+		}
+		index[rule.ID] = len(merged.Rules)
+		merged.Rules = append(merged.Rules, rule)
+	}
+
+	return merged
+}
+
+func (r CleanerRule) validate() error {
+	if r.ID == "" {
+		return errors.New("rule without id")
+	}
+	if r.Disabled {
+		return nil
+	}
+	if r.Category == "" {
+		return fmt.Errorf("rule %s has no category", r.ID)
+	}
+	if _, err := r.minAge(); err != nil {
+		return fmt.Errorf("rule %s: %w", r.ID, err)
+	}
+	_, pathProvider := rulePathProviders[r.Provider]
+	_, profileProvider := ruleProfileProviders[r.Provider]
+	if r.Provider != "" && !pathProvider && !profileProvider {
+		return fmt.Errorf("rule %s has an unknown provider %q", r.ID, r.Provider)
+	}
+	if r.CleanMethod != "" && r.CleanMethod != CleanMethodMakeWritable && r.CleanMethod != CleanMethodTrashEntry {
+		return fmt.Errorf("rule %s has an unknown cleanMethod %q", r.ID, r.CleanMethod)
+	}
+	if r.KeepRotations < 0 {
+		return fmt.Errorf("rule %s has a negative keepRotations", r.ID)
+	}
+	if r.KeepVersions < 0 {
+		return fmt.Errorf("rule %s has a negative keepVersions", r.ID)
+	}
+	if _, err := parseByteSize(r.TruncateOver); err != nil {
+		return fmt.Errorf("rule %s: %w", r.ID, err)
+	}
+	for _, pattern := range append(append([]string{}, r.Include...), r.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("rule %s has a bad pattern %q: %w", r.ID, pattern, err)
+		}
+	}
+	return nil
+}
+
+func (r CleanerRule) appliesToOS() bool {
+	return appliesToOS(r.OS)
+}
+
+// appliesToOS reports whether an OS list is empty or names the current OS
+func appliesToOS(list []string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, goos := range list {
+		if goos == runtime.GOOS {
+			return true
+		}
+	}
+	return false
+}
+
+func (r CleanerRule) minAge() (time.Duration, error) {
+	if r.MinAge == "" {
+		return 0, nil
+	}
+	age, err := time.ParseDuration(r.MinAge)
+	if err != nil {
+		return 0, fmt.Errorf("bad minAge %q: %w", r.MinAge, err)
+	}
+	return age, nil
+}
+
+// matches reports whether an entry name passes the rule's include and exclude globs
+func (r CleanerRule) matches(name string) bool {
+	for _, pattern := range r.Exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return false
+		}
+	}
+
+	if len(r.Include) == 0 {
+		return true
+	}
+	for _, pattern := range r.Include {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanerDirs resolves the rules that apply to this OS into existing directories to scan.
+// Each resolved path is only returned once, by the first rule that names it.
+func cleanerDirs(rules CleanerRuleSet) []DirInfo {
+	var dirs []DirInfo
+	seen := map[string]bool{}
+
+	for _, rule := range rules.Rules {
+		if rule.Disabled || !rule.appliesToOS() {
+			continue
+		}
+
+		minAge, err := rule.minAge()
+		if err != nil {
+			continue
+		}
+
+		for _, dir := range rule.resolveDirs() {
+			path := dir.Path
+			if seen[path] {
+				continue
+			}
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				continue
+			}
+			seen[path] = true
+
+			dirs = append(dirs, DirInfo{
+				Path:           path,
+				Location:       rule.Category,
+				Profile:        dir.Profile,
+				RuleID:         rule.ID,
+				MinAge:         minAge,
+				NeedsElevation: rule.RequiresElevation || needsElevatedPermissions(path),
+				rule:           rule,
+			})
+		}
+	}
+
+	// A rule covering a whole cache directory leaves the parts other rules cover alone
+	for i := range dirs {
+		for _, other := range dirs {
+			if other.Path != dirs[i].Path && isWithin(dirs[i].Path, other.Path) {
+				dirs[i].nested = append(dirs[i].nested, other.Path)
+			}
+		}
+	}
+
+	return dirs
+}
+
+// resolveDirs returns the absolute paths named by the rule's templates and provider
+func (r CleanerRule) resolveDirs() []ruleDir {
+	var dirs []ruleDir
+	for _, template := range r.Paths {
+		for _, path := range expandRulePath(template) {
+			dirs = append(dirs, ruleDir{Path: path})
+		}
+	}
+
+	if provider, exists := rulePathProviders[r.Provider]; exists {
+		for _, path := range provider() {
+			dirs = append(dirs, ruleDir{Path: path})
+		}
+	}
+	if provider, exists := ruleProfileProviders[r.Provider]; exists {
+		dirs = append(dirs, provider()...)
+	}
+
+	resolved := dirs[:0]
+	for _, dir := range dirs {
+		if dir.Path != "" && filepath.IsAbs(dir.Path) {
+			dir.Path = filepath.Clean(dir.Path)
+			resolved = append(resolved, dir)
+		}
+	}
+	return resolved
+}
+
+// expandRulePath expands ~, ${VAR} and globs in a path template. Templates that reference
+// an unset variable without a default resolve to nothing rather than a relative path.
+func expandRulePath(template string) []string {
+	missing := false
+	expanded := os.Expand(template, func(name string) string {
+		value := rulePathVar(name)
+		if value == "" {
+			missing = true
+		}
+		return value
+	})
+	if missing {
+		return nil
+	}
+
+	if expanded == "~" || strings.HasPrefix(expanded, "~/") {
+		home := userHomeDir()
+		if home == "" {
+			return nil
+		}
+		expanded = home + expanded[1:]
+	}
+
+	expanded = filepath.Clean(filepath.FromSlash(expanded))
+	if !filepath.IsAbs(expanded) {
+		return nil
+	}
+
+	if !strings.ContainsAny(expanded, "*?[") {
+		return []string{expanded}
+	}
+
+	matches, err := filepath.Glob(expanded)
+	if err != nil {
+		return nil
+	}
+	return matches
+}
+
+// rulePathVar looks up a variable for a path template, falling back to the
+// XDG base directory defaults
+func rulePathVar(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	home := userHomeDir()
+	if home == "" {
+		return ""
+	}
+
+	switch name {
+	case "HOME":
+		return home
+	case "TEMP":
+		return os.TempDir()
+	case "XDG_CACHE_HOME":
+		return filepath.Join(home, ".cache")
+	case "XDG_CONFIG_HOME":
+		return filepath.Join(home, ".config")
+	case "XDG_DATA_HOME":
+		return filepath.Join(home, ".local", "share")
+	case "XDG_STATE_HOME":
+		return filepath.Join(home, ".local", "state")
+	}
+	return ""
+}
+
+func userHomeDir() string {
+	if runtime.GOOS == "windows" {
+		return os.Getenv("USERPROFILE")
+	}
+	return os.Getenv("HOME")
+}
+
+// loadCleanerRulesOrDefault never fails: a broken override file falls back to the built-ins
+func loadCleanerRulesOrDefault() CleanerRuleSet {
+	rules, _ := LoadCleanerRules()
+	return rules
+}
+
+// cleanerRuleIndex maps rule IDs to rules
+func cleanerRuleIndex(rules CleanerRuleSet) map[string]CleanerRule {
+	index := make(map[string]CleanerRule, len(rules.Rules))
+	for _, rule := range rules.Rules {
+		index[rule.ID] = rule
+	}
+	return index
+}
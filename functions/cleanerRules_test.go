@@ -0,0 +1,106 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuiltInCleanerRulesAreValid(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("APPDATA", t.TempDir())
+
+	rules, err := LoadCleanerRules()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(rules.Rules) == 0 {
+		t.Fatalf("Expected built-in rules, got none")
+	}
+
+	seen := map[string]bool{}
+	for _, rule := range rules.Rules {
+		if err := rule.validate(); err != nil {
+			t.Errorf("Invalid built-in rule: %v", err)
+		}
+		if seen[rule.ID] {
+			t.Errorf("Duplicate rule id: %s", rule.ID)
+		}
+		seen[rule.ID] = true
+	}
+}
+
+func TestUserCleanerRulesOverrideBuiltIns(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("APPDATA", configDir)
+
+	path, err := CleanerRulesPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrides := `{"rules": [
+		{"id": "system-temp", "disabled": true},
+		{"id": "custom", "category": "Custom", "paths": ["${HOME}/custom-cache"], "exclude": ["keep-*"]}
+	]}`
+	if err := os.WriteFile(path, []byte(overrides), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadCleanerRules()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	index := cleanerRuleIndex(rules)
+	if !index["system-temp"].Disabled {
+		t.Errorf("Expected system-temp to be disabled by the override")
+	}
+
+	custom, exists := index["custom"]
+	if !exists {
+		t.Fatalf("Expected custom rule to be added")
+	}
+	if custom.matches("keep-me") || !custom.matches("drop-me") {
+		t.Errorf("Expected exclude globs to filter entry names")
+	}
+
+	t.Setenv("HOME", "/home/tester")
+	t.Setenv("USERPROFILE", "/home/tester")
+	if got := expandRulePath(custom.Paths[0]); len(got) != 1 || got[0] != filepath.FromSlash("/home/tester/custom-cache") {
+		t.Errorf("Expected expanded path, got: %v", got)
+	}
+}
+
+func TestNestedRuleDirectoriesAreLeftToTheirRule(t *testing.T) {
+	cache := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	for _, rel := range []string{"Google/Chrome/Default/Cache/data", "Other/data"} {
+		path := filepath.Join(cache, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, rel := range []string{"Google", "Other"} {
+		os.Chtimes(filepath.Join(cache, rel), old, old)
+	}
+
+	rules := CleanerRuleSet{Rules: []CleanerRule{
+		{ID: "outer", Category: "User Cache", Paths: []string{cache}},
+		{ID: "inner", Category: "Browser Cache", Paths: []string{filepath.Join(cache, "Google", "Chrome")}},
+	}}
+	dirs := cleanerDirs(rules)
+	if len(dirs) != 2 || len(dirs[0].nested) != 1 || len(dirs[1].nested) != 0 {
+		t.Fatalf("Expected the outer directory to know about the inner one, got: %+v", dirs)
+	}
+
+	files, _ := newCleanerScanner(context.Background(), nil).scanDirectory(dirs[0])
+	if len(files) != 1 || files[0].Name != "Other" {
+		t.Errorf("Expected only Other to be offered by the outer rule, got: %+v", files)
+	}
+}
@@ -0,0 +1,202 @@
+package functions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fileIdentity identifies a file independently of its path (device and inode on Unix,
+// volume serial and file index on Windows)
+type fileIdentity struct {
+	Device uint64
+	Inode  uint64
+}
+
+func (id fileIdentity) String() string {
+	return fmt.Sprintf("%d:%d", id.Device, id.Inode)
+}
+
+// scannedEntry is what a scan saw at a path
+type scannedEntry struct {
+	root string
+	// ruleID is the rule the scan found the entry by; a FileInfo's own RuleID is
+	// never trusted for how an entry is cleaned
+	ruleID   string
+	identity fileIdentity
+	fileType os.FileMode
+	// truncateOnly entries may be emptied but never removed
+	truncateOnly bool
+	// scope is the search that found the entry
+	scope scanScope
+}
+
+// scanScope separates the entries of independent searches, so a duplicate search
+// doesn't make its files deletable through the cleaner or the other way round
+type scanScope int
+
+const (
+	// scopeCleaner holds what the last cleaner scan found
+	scopeCleaner scanScope = iota
+	// scopeArtifacts holds the build output directories of the last artifact search
+	scopeArtifacts
+	// scopeCompress holds the candidates of the last compressible file search
+	scopeCompress
+	// scopeDuplicates holds the copies in the groups of the last duplicate search
+	scopeDuplicates
+)
+
+// searches returns the scopes a clean in scope accepts entries from. Build artifacts
+// and compressible files are cleaned through CleanFiles like the cleaner's entries,
+// each search only replaces its own. Compressible files are only ever compressed,
+// which the clean checks enforce.
+func (scope scanScope) searches() []scanScope {
+	if scope == scopeCleaner {
+		return []scanScope{scopeCleaner, scopeArtifacts, scopeCompress}
+	}
+	return []scanScope{scope}
+}
+
+// scannedFiles records every entry handed to the frontend by a scan. Deletion only
+// accepts paths found here, so a crafted or stale FileInfo can't point the cleaner
+// somewhere else.
+var scannedFiles struct {
+	sync.RWMutex
+	scopes map[scanScope]map[string]scannedEntry
+}
+
+// registerScannedFile remembers that the cleaner scan found path in dir and returns
+// its identity for FileInfo.FileID
+func registerScannedFile(dir DirInfo, path string, info os.FileInfo) string {
+	return registerScopedFile(scopeCleaner, dir.Path, dir.RuleID, path, info)
+}
+
+// registerScopedFile remembers that a search found path below root, by rule ruleID
+// if it went by the cleaner rules
+func registerScopedFile(scope scanScope, root, ruleID, path string, info os.FileInfo) string {
+	identity, ok := identityOf(path, info)
+	if !ok {
+		return ""
+	}
+
+	scannedFiles.Lock()
+	defer scannedFiles.Unlock()
+
+	if scannedFiles.scopes == nil {
+		scannedFiles.scopes = map[scanScope]map[string]scannedEntry{}
+	}
+	if scannedFiles.scopes[scope] == nil {
+		scannedFiles.scopes[scope] = map[string]scannedEntry{}
+	}
+	scannedFiles.scopes[scope][path] = scannedEntry{root: root, ruleID: ruleID, identity: identity, fileType: info.Mode().Type(), scope: scope}
+
+	return identity.String()
+}
+
+// resetScannedFiles forgets everything registered in scope, before a search starts over
+func resetScannedFiles(scope scanScope) {
+	scannedFiles.Lock()
+	defer scannedFiles.Unlock()
+	delete(scannedFiles.scopes, scope)
+}
+
+// forgetScannedFile drops path from scope, once it is gone
+func forgetScannedFile(scope scanScope, path string) {
+	scannedFiles.Lock()
+	defer scannedFiles.Unlock()
+	delete(scannedFiles.scopes[scope], path)
+}
+
+func lookupScannedFile(scope scanScope, path string) (scannedEntry, bool) {
+	scannedFiles.RLock()
+	defer scannedFiles.RUnlock()
+
+	for _, search := range scope.searches() {
+		if entry, exists := scannedFiles.scopes[search][path]; exists {
+			return entry, true
+		}
+	}
+	return scannedEntry{}, false
+}
+
+// scannedRoot returns the directory below which a scan found path
+func scannedRoot(path string) (string, bool) {
+	entry, exists := lookupScannedFile(scopeCleaner, path)
+	return entry.root, exists
+}
+
+// markTruncateOnly records that the scan offered path for truncation only
+func markTruncateOnly(path string) {
+	scannedFiles.Lock()
+	defer scannedFiles.Unlock()
+
+	if entry, exists := scannedFiles.scopes[scopeCleaner][path]; exists {
+		entry.truncateOnly = true
+		scannedFiles.scopes[scopeCleaner][path] = entry
+	}
+}
+
+// verifyScannedPath re-checks, right before deletion, that path was produced by a scan,
+// still sits under that scan's root without passing through a symlink, and is the
+// same file that was scanned. It returns what the scan recorded about path.
+func verifyScannedPath(scope scanScope, path string) (scannedEntry, SkipReason, bool) {
+	if path == "" || !filepath.IsAbs(path) || filepath.Clean(path) != path {
+		return scannedEntry{}, SkipInvalidPath, true
+	}
+
+	entry, exists := lookupScannedFile(scope, path)
+	if !exists {
+		return scannedEntry{}, SkipNotScanned, true
+	}
+
+	if !isWithin(entry.root, path) {
+		return scannedEntry{}, SkipOutsideScanRoot, true
+	}
+
+	// A directory on the way down may have been swapped for a symlink since the scan
+	realRoot, err := filepath.EvalSymlinks(entry.root)
+	if err != nil {
+		return scannedEntry{}, SkipOutsideScanRoot, true
+	}
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return scannedEntry{}, SkipFileChanged, true
+	}
+	rel, _ := filepath.Rel(entry.root, filepath.Dir(path))
+	if realParent != filepath.Join(realRoot, rel) {
+		return scannedEntry{}, SkipOutsideScanRoot, true
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return scannedEntry{}, SkipFileChanged, true
+	}
+	// Inode numbers get reused, so the file type has to match as well
+	identity, ok := identityOf(path, info)
+	if !ok || identity != entry.identity || info.Mode().Type() != entry.fileType {
+		return scannedEntry{}, SkipFileChanged, true
+	}
+
+	return entry, "", false
+}
+
+// isWithin reports whether path is root or below it
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// sameDevice reports whether info is on device; it is always true where the
+// device can't be read
+func sameDevice(info os.FileInfo, device uint64, known bool) bool {
+	if !known {
+		return true
+	}
+	dev, ok := deviceOf(info)
+	return !ok || dev == device
+}
@@ -0,0 +1,74 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScannedPathsAreVerified(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	write := func(path string) {
+		writeTestFile(t, path, []byte("data"))
+		backdate(t, path)
+	}
+
+	dir := DirInfo{Path: root, RuleID: "user-cache"}
+	kept := filepath.Join(root, "kept.bin")
+	swapped := filepath.Join(root, "swapped.bin")
+	linked := filepath.Join(root, "sub", "file.bin")
+	for _, path := range []string{kept, swapped, linked} {
+		write(path)
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		registerScannedFile(dir, path, info)
+	}
+
+	// Replaced by another file after the scan
+	replacement := filepath.Join(root, "replacement.bin")
+	write(replacement)
+	if err := os.Rename(replacement, swapped); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory on the way swapped for a symlink to a look-alike elsewhere
+	write(filepath.Join(outside, "file.bin"))
+	if err := os.Rename(filepath.Join(root, "sub"), filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "sub")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	cases := []struct {
+		name   string
+		path   string
+		reason SkipReason
+	}{
+		{"scanned", kept, ""},
+		{"never scanned", filepath.Join(root, "other.bin"), SkipNotScanned},
+		{"relative", "kept.bin", SkipInvalidPath},
+		{"swapped after the scan", swapped, SkipFileChanged},
+		{"symlinked parent", linked, SkipOutsideScanRoot},
+	}
+	for _, c := range cases {
+		if _, reason, _ := verifyScannedPath(scopeCleaner, c.path); reason != c.reason {
+			t.Errorf("%s: got %q, want %q", c.name, reason, c.reason)
+		}
+	}
+
+	// The rule and the truncate flag come from the scan, whatever the caller says
+	plan := planClean([]FileInfo{{Path: kept, Size: 4, RuleID: "go-module-cache", Truncate: true}}, CleanOptions{})
+	if item := plan.Items[0]; item.Action != ActionRemove || item.File.RuleID != "user-cache" || item.File.Truncate {
+		t.Errorf("Expected the scanned rule and no truncation, got: %+v", item)
+	}
+
+	// A new scan forgets the entries of the last one
+	resetScannedFiles(scopeCleaner)
+	if _, reason, _ := verifyScannedPath(scopeCleaner, kept); reason != SkipNotScanned {
+		t.Errorf("Expected a reset to forget kept.bin, got %q", reason)
+	}
+}
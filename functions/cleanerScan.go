@@ -0,0 +1,305 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scanProgressInterval limits how often progress is reported
+const scanProgressInterval = 100 * time.Millisecond
+
+// ScanProgress is reported while a cleaner scan is running
+type ScanProgress struct {
+	CurrentDir   string `json:"currentDir"`
+	FilesCounted int64  `json:"filesCounted"`
+	BytesFound   int64  `json:"bytesFound"`
+	Done         bool   `json:"done"`
+}
+
+// ScanProgressFunc receives scan progress; it is never called concurrently
+type ScanProgressFunc func(ScanProgress)
+
+// cleanerScanner sizes directories with a bounded pool of workers
+type cleanerScanner struct {
+	ctx      context.Context
+	workers  chan struct{}
+	progress ScanProgressFunc
+	// openFiles is set by the cleaner scans so entries in use can be skipped
+	openFiles *openFileIndex
+	// cache is set by the cleaner scans to reuse the sizes of unchanged directories
+	cache *scanCache
+
+	filesCounted atomic.Int64
+	bytesFound   atomic.Int64
+	lastReport   atomic.Int64
+
+	reportMu sync.Mutex
+
+	// resultsMu guards what scanners collect besides the cleanable files
+	resultsMu  sync.Mutex
+	skipped    []SkippedFile
+	thumbnails []ThumbnailFolderUsage
+}
+
+func newCleanerScanner(ctx context.Context, progress ScanProgressFunc) *cleanerScanner {
+	return &cleanerScanner{
+		ctx:      ctx,
+		workers:  make(chan struct{}, runtime.NumCPU()*2),
+		progress: progress,
+	}
+}
+
+// report sends progress, at most once per scanProgressInterval unless done is set
+func (s *cleanerScanner) report(currentDir string, done bool) {
+	if s.progress == nil {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := s.lastReport.Load()
+	if !done && (now-last < int64(scanProgressInterval) || !s.lastReport.CompareAndSwap(last, now)) {
+		return
+	}
+
+	s.reportMu.Lock()
+	defer s.reportMu.Unlock()
+
+	s.progress(ScanProgress{
+		CurrentDir:   currentDir,
+		FilesCounted: s.filesCounted.Load(),
+		BytesFound:   s.bytesFound.Load(),
+		Done:         done,
+	})
+}
+
+// scanDirectory lists the top-level entries of a cleanable directory with their sizes.
+// Entries are sized concurrently; the returned order matches the directory listing.
+func (s *cleanerScanner) scanDirectory(dir DirInfo) ([]FileInfo, int64) {
+	if scan, exists := ruleEntryScanners[dir.rule.Provider]; exists {
+		return scan(s, dir)
+	}
+
+	var files []FileInfo
+	var totalSize int64
+
+	entries, err := os.ReadDir(dir.Path)
+	if err != nil {
+		return files, 0
+	}
+
+	// Never leave the filesystem the cleanable directory is on
+	rootInfo, err := os.Stat(dir.Path)
+	if err != nil {
+		return files, 0
+	}
+	device, deviceKnown := deviceOf(rootInfo)
+
+	results := make([]*FileInfo, len(entries))
+	var wg sync.WaitGroup
+
+	for i, entry := range entries {
+		if s.ctx.Err() != nil {
+			break
+		}
+
+		fullPath := filepath.Join(dir.Path, entry.Name())
+
+		// Skip entries filtered out by the rule's include/exclude globs, and those
+		// holding another rule's directory
+		if !dir.rule.matches(entry.Name()) || dir.holdsNested(fullPath) {
+			continue
+		}
+
+		// Skip protected paths, recording which rule excluded them
+		if protection, protected := protectionFor(fullPath); protected {
+			s.addSkipped(SkippedFile{
+				File: FileInfo{
+					Path:     fullPath,
+					Name:     entry.Name(),
+					Location: dir.Location,
+					Profile:  dir.Profile,
+					RuleID:   dir.RuleID,
+				},
+				Reason:      protectionSkipReason(protection),
+				ProtectedBy: protection,
+			})
+			continue
+		}
+
+		s.workers <- struct{}{}
+		wg.Add(1)
+		go func(i int, name, fullPath string) {
+			defer wg.Done()
+			defer func() { <-s.workers }()
+
+			// Lstat so that a symlink is sized as itself, not as its target
+			info, err := os.Lstat(fullPath)
+			if err != nil || !sameDevice(info, device, deviceKnown) {
+				return
+			}
+
+			// Skip files younger than the rule allows, or than the in-use fallback
+			if time.Since(info.ModTime()) < s.openFiles.ageGuard(dir.MinAge, info) {
+				return
+			}
+
+			size := int64(0)
+			if info.IsDir() {
+				size = s.dirSize(fullPath, device, deviceKnown)
+			} else {
+				size = info.Size()
+				s.filesCounted.Add(1)
+				s.bytesFound.Add(size)
+			}
+
+			file := FileInfo{
+				Path:           fullPath,
+				Size:           size,
+				Name:           name,
+				Location:       dir.Location,
+				Profile:        dir.Profile,
+				NeedsElevation: dir.NeedsElevation,
+				RuleID:         dir.RuleID,
+				FileID:         registerScannedFile(dir, fullPath, info),
+			}
+			if details, exists := ruleEntryDetails[dir.rule.Provider]; exists {
+				details(&file)
+			}
+
+			// Skip files being used by a running process
+			if openedBy := s.openFiles.openedBy(fullPath); len(openedBy) > 0 {
+				s.addSkipped(SkippedFile{File: file, Reason: SkipInUse, OpenedBy: openedBy})
+				return
+			}
+
+			results[i] = &file
+		}(i, entry.Name(), fullPath)
+	}
+
+	wg.Wait()
+
+	for _, file := range results {
+		if file != nil {
+			files = append(files, *file)
+			totalSize += file.Size
+		}
+	}
+
+	return files, totalSize
+}
+
+func (s *cleanerScanner) addSkipped(skipped SkippedFile) {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	s.skipped = append(s.skipped, skipped)
+}
+
+// skippedFiles returns the entries skipped so far, sorted by path
+func (s *cleanerScanner) skippedFiles() []SkippedFile {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+
+	skipped := append([]SkippedFile{}, s.skipped...)
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].File.Path < skipped[j].File.Path })
+	return skipped
+}
+
+// dirSize returns the total size of the files below path. Subdirectories are handed
+// to another worker when one is free and walked inline otherwise; symlinks are never
+// followed and directories on another device are skipped. With a scan cache, only
+// directories that changed since the last scan are read.
+func (s *cleanerScanner) dirSize(path string, device uint64, deviceKnown bool) int64 {
+	if s.ctx.Err() != nil {
+		return 0
+	}
+
+	listing, cached := s.cache.lookup(path)
+	if !cached {
+		var ok bool
+		if listing, ok = s.listDir(path); !ok {
+			return 0
+		}
+	}
+
+	s.report(path, false)
+	s.filesCounted.Add(listing.Files)
+	s.bytesFound.Add(listing.Size)
+
+	size := listing.Size
+	var childSize atomic.Int64
+	var wg sync.WaitGroup
+
+	for _, name := range listing.Dirs {
+		if s.ctx.Err() != nil {
+			break
+		}
+
+		childPath := filepath.Join(path, name)
+		if deviceKnown {
+			info, err := os.Lstat(childPath)
+			if err != nil || !info.IsDir() || !sameDevice(info, device, deviceKnown) {
+				continue
+			}
+		}
+
+		select {
+		case s.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-s.workers }()
+				childSize.Add(s.dirSize(childPath, device, deviceKnown))
+			}()
+		default:
+			size += s.dirSize(childPath, device, deviceKnown)
+		}
+	}
+
+	wg.Wait()
+	return size + childSize.Load()
+}
+
+// listDir reads a directory, totalling its files and naming its subdirectories
+// other than protected ones, and records the result in the scan cache
+func (s *cleanerScanner) listDir(path string) (scanCacheEntry, bool) {
+	var info os.FileInfo
+	if s.cache != nil {
+		var err error
+		if info, err = os.Lstat(path); err != nil {
+			return scanCacheEntry{}, false
+		}
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return scanCacheEntry{}, false
+	}
+
+	listing := scanCacheEntry{Dirs: []string{}}
+	for _, entry := range entries {
+		// Protected entries aren't counted; a clean refuses their parent
+		if isProtectedPath(filepath.Join(path, entry.Name())) {
+			continue
+		}
+		if entry.IsDir() {
+			listing.Dirs = append(listing.Dirs, entry.Name())
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		listing.Files++
+		listing.Size += info.Size()
+	}
+
+	s.cache.store(path, info, listing)
+	return listing, true
+}
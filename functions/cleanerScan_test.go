@@ -0,0 +1,62 @@
+package functions
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanDirectory(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]int{
+		"a.bin":             100,
+		"nested/b.bin":      200,
+		"nested/deep/c.bin": 300,
+	}
+	for rel, size := range files {
+		writeTestFile(t, filepath.Join(root, filepath.FromSlash(rel)), make([]byte, size))
+	}
+	backdate(t, filepath.Join(root, "a.bin"), filepath.Join(root, "nested"))
+
+	var reports []ScanProgress
+	scanner := newCleanerScanner(context.Background(), func(p ScanProgress) { reports = append(reports, p) })
+	got, total := scanner.scanDirectory(DirInfo{Path: root})
+	scanner.report(root, true)
+
+	if total != 600 || len(got) != 2 {
+		t.Errorf("Expected 600 bytes in 2 entries, got %d bytes in %+v", total, got)
+	}
+	sizes := map[string]int64{}
+	for _, file := range got {
+		sizes[file.Name] = file.Size
+	}
+	if sizes["a.bin"] != 100 || sizes["nested"] != 500 {
+		t.Errorf("Expected nested to be sized recursively, got %v", sizes)
+	}
+	if len(reports) == 0 {
+		t.Fatal("Expected progress to be reported")
+	}
+	last := reports[len(reports)-1]
+	if !last.Done || last.FilesCounted != 3 || last.BytesFound != 600 {
+		t.Errorf("Expected a final report for 3 files and 600 bytes, got %+v", last)
+	}
+}
+
+func TestScanDirectoryCancelled(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.bin", "b.bin"} {
+		writeTestFile(t, filepath.Join(root, name), []byte("data"))
+		backdate(t, filepath.Join(root, name))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	scanner := newCleanerScanner(ctx, nil)
+
+	if got, total := scanner.scanDirectory(DirInfo{Path: root}); len(got) != 0 || total != 0 {
+		t.Errorf("Expected a cancelled scan to find nothing, got %d bytes in %+v", total, got)
+	}
+	if size := scanner.dirSize(root, 0, false); size != 0 {
+		t.Errorf("Expected a cancelled dirSize to return 0, got %d", size)
+	}
+}
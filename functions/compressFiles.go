@@ -0,0 +1,363 @@
+package functions
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	compressibleCategory = "Compressible Files"
+
+	defaultCompressMinSize    = 10 << 20
+	defaultCompressMinAgeDays = 30
+	// Files must shrink by at least this much to be worth compressing
+	defaultCompressMinSavings = 20
+
+	// Savings of bigger files are estimated from compressionSamples chunks
+	// spread over the file instead of compressing all of it
+	compressionSampleSize = 256 << 10
+	compressionSamples    = 4
+)
+
+// Text formats that usually compress well. Rotated logs (syslog.1, app.log-20240131)
+// are always included.
+var defaultCompressExtensions = []string{".log", ".txt", ".csv", ".tsv", ".json", ".jsonl", ".ndjson", ".xml", ".sql", ".out", ".trace"}
+
+// CompressOptions configures FindCompressibleFiles
+type CompressOptions struct {
+	// MinSize in bytes, 10 MiB if zero
+	MinSize int64 `json:"minSize"`
+	// MinAgeDays since the last modification, 30 if zero
+	MinAgeDays int `json:"minAgeDays"`
+	// Extensions replaces the default list of text extensions, e.g. ".log"
+	Extensions []string `json:"extensions"`
+	// MinSavingsPercent is the estimated reduction a file needs, 20 if zero
+	MinSavingsPercent int `json:"minSavingsPercent"`
+}
+
+// CompressCandidate is a file that can be gzipped in place
+type CompressCandidate struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// EstimatedSize of the .gz, extrapolated from a sample of the file
+	EstimatedSize    int64 `json:"estimatedSize"`
+	EstimatedSavings int64 `json:"estimatedSavings"`
+	// File is the entry to pass to CleanFilesWithOptions with CleanModeCompress
+	File FileInfo `json:"file"`
+}
+
+// CompressReport is the result of FindCompressibleFiles
+type CompressReport struct {
+	Candidates       []CompressCandidate `json:"candidates"`
+	TotalSize        int64               `json:"totalSize"`
+	EstimatedSavings int64               `json:"estimatedSavings"`
+}
+
+// FindCompressibleFiles looks below roots for large, old text files and estimates
+// how much gzipping each of them would save, biggest savings first
+func FindCompressibleFiles(ctx context.Context, roots []string, options CompressOptions, progress ScanProgressFunc) (*CompressReport, error) {
+	if options.MinSize <= 0 {
+		options.MinSize = defaultCompressMinSize
+	}
+	if options.MinAgeDays <= 0 {
+		options.MinAgeDays = defaultCompressMinAgeDays
+	}
+	if options.MinSavingsPercent <= 0 {
+		options.MinSavingsPercent = defaultCompressMinSavings
+	}
+	extensions := options.Extensions
+	if len(extensions) == 0 {
+		extensions = defaultCompressExtensions
+	}
+	minAge := time.Duration(options.MinAgeDays) * 24 * time.Hour
+
+	scanner := newCleanerScanner(ctx, progress)
+	resetScannedFiles(scopeCompress)
+	var candidates []CompressCandidate
+
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		if isProtectedPath(root) {
+			return nil, fmt.Errorf("refusing to scan protected path: %s", root)
+		}
+		rootInfo, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		device, deviceKnown := deviceOf(rootInfo)
+
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && (vcsDirs[d.Name()] || isProtectedPath(path)) {
+					return filepath.SkipDir
+				}
+				scanner.report(path, false)
+				return nil
+			}
+			if !d.Type().IsRegular() || !isCompressibleName(d.Name(), extensions) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil || info.Size() < options.MinSize || time.Since(info.ModTime()) < minAge {
+				return nil
+			}
+			if !sameDevice(info, device, deviceKnown) || isProtectedPath(path) {
+				return nil
+			}
+			scanner.filesCounted.Add(1)
+			scanner.bytesFound.Add(info.Size())
+
+			candidates = append(candidates, CompressCandidate{
+				Path:    path,
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+				File: FileInfo{
+					Path:     path,
+					Size:     info.Size(),
+					Name:     d.Name(),
+					Location: compressibleCategory,
+					FileID:   registerScopedFile(scopeCompress, root, "", path, info),
+				},
+			})
+			return nil
+		})
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Estimate concurrently; each estimate reads up to 1 MiB
+	var wg sync.WaitGroup
+	for i := range candidates {
+		candidate := &candidates[i]
+		scanner.workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-scanner.workers }()
+			if ctx.Err() != nil {
+				return
+			}
+			estimate, err := estimateCompressedSize(candidate.Path, candidate.Size)
+			if err != nil {
+				return
+			}
+			candidate.EstimatedSize = estimate
+			candidate.EstimatedSavings = candidate.Size - estimate
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &CompressReport{Candidates: []CompressCandidate{}}
+	for _, candidate := range candidates {
+		if candidate.EstimatedSavings*100 < candidate.Size*int64(options.MinSavingsPercent) {
+			continue
+		}
+		report.Candidates = append(report.Candidates, candidate)
+		report.TotalSize += candidate.Size
+		report.EstimatedSavings += candidate.EstimatedSavings
+	}
+	sort.Slice(report.Candidates, func(i, j int) bool {
+		return report.Candidates[i].EstimatedSavings > report.Candidates[j].EstimatedSavings
+	})
+
+	scanner.report("", true)
+	return report, nil
+}
+
+// isCompressibleName reports whether a file name has one of extensions, or is a
+// rotated log. Already compressed files never are.
+func isCompressibleName(name string, extensions []string) bool {
+	if compressedLogExt.MatchString(name) {
+		return false
+	}
+	if _, rotated := rotatedLogBase(name); rotated {
+		return true
+	}
+
+	ext := filepath.Ext(name)
+	for _, candidate := range extensions {
+		if strings.EqualFold(ext, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// estimateCompressedSize gzips a file, or for big files a few chunks spread over
+// it, and extrapolates the size of the result
+func estimateCompressedSize(path string, size int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var counter countingWriter
+	gz := gzip.NewWriter(&counter)
+
+	var sampled int64
+	if size <= compressionSampleSize*compressionSamples {
+		if sampled, err = io.Copy(gz, f); err != nil {
+			return 0, err
+		}
+	} else {
+		step := (size - compressionSampleSize) / (compressionSamples - 1)
+		for i := int64(0); i < compressionSamples; i++ {
+			n, err := io.Copy(gz, io.NewSectionReader(f, i*step, compressionSampleSize))
+			if err != nil {
+				return 0, err
+			}
+			sampled += n
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	if sampled == 0 {
+		return size, nil
+	}
+
+	return int64(float64(counter.n) / float64(sampled) * float64(size)), nil
+}
+
+// countingWriter discards what is written to it and counts the bytes
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// compressFile replaces path by path.gz, keeping its mode, owner and modification
+// time. The archive is written to a temporary file and synced before it is linked
+// into place, and the original is only removed after that, so a crash leaves one
+// complete copy. It returns the bytes saved.
+func compressFile(path string) (int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	target := path + ".gz"
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".gz-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	gz := gzip.NewWriter(tmp)
+	gz.Name = filepath.Base(path)
+	gz.ModTime = info.ModTime()
+	if _, err := io.Copy(gz, src); err != nil {
+		return 0, fmt.Errorf("error compressing %s: %w", path, err)
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	if err := chownLike(tmp, info); err != nil {
+		return 0, fmt.Errorf("error keeping the owner of %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Chtimes(tmp.Name(), time.Time{}, info.ModTime()); err != nil {
+		return 0, err
+	}
+
+	// Anything written while compressing would be lost with the original
+	if current, err := os.Lstat(path); err != nil || current.Size() != info.Size() || !current.ModTime().Equal(info.ModTime()) {
+		return 0, errors.New("file changed while it was being compressed")
+	}
+
+	compressed, err := os.Stat(tmp.Name())
+	if err != nil {
+		return 0, err
+	}
+	// Placing fails if the target exists, so a .gz that appeared meanwhile is never replaced
+	if err := placeNewFile(tmp.Name(), target); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return 0, fmt.Errorf("%s already exists", target)
+		}
+		return 0, err
+	}
+	syncDir(filepath.Dir(path))
+
+	if err := os.Remove(path); err != nil {
+		os.Remove(target)
+		return 0, err
+	}
+	syncDir(filepath.Dir(path))
+
+	return info.Size() - compressed.Size(), nil
+}
+
+// linkFile is os.Link, replaceable in tests to act like a filesystem without hard links
+var linkFile = os.Link
+
+// placeNewFile moves src to dst, failing with fs.ErrExist if dst exists. It hard links
+// where it can; on filesystems without hard links (FAT, exFAT, some network shares)
+// it creates dst exclusively and renames src over that placeholder instead.
+func placeNewFile(src, dst string) error {
+	err := linkFile(src, dst)
+	if err == nil || errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	placeholder, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	placeholder.Close()
+	if err := os.Rename(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
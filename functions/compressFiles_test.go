@@ -0,0 +1,184 @@
+package functions
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsCompressibleName(t *testing.T) {
+	cases := map[string]bool{
+		"app.log":           true,
+		"export.CSV":        true,
+		"syslog.1":          true,
+		"auth.log-20240131": true,
+		"syslog.2.gz":       false,
+		"archive.tar.xz":    false,
+		"photo.jpg":         false,
+	}
+	for name, want := range cases {
+		if got := isCompressibleName(name, defaultCompressExtensions); got != want {
+			t.Errorf("isCompressibleName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestCompressFiles(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	text := []byte(strings.Repeat("2024-01-31 12:00:00 INFO request served in 12ms\n", 40000))
+	noise := make([]byte, len(text))
+	rand.Read(noise)
+
+	old := time.Now().AddDate(0, -2, 0).Truncate(time.Second)
+	write := func(name string, data []byte, modTime time.Time) string {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, data, 0640); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, modTime, modTime)
+		return path
+	}
+	logPath := write("server.log", text, old)
+	write("random.log", noise, old)
+	write("recent.log", text, time.Now())
+	write("small.log", []byte("tiny"), old)
+
+	report, err := FindCompressibleFiles(context.Background(), []string{root}, CompressOptions{MinSize: 1024}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Candidates) != 1 || report.Candidates[0].Path != logPath {
+		t.Fatalf("Expected only the old, repetitive log, got: %+v", report.Candidates)
+	}
+	if savings := report.Candidates[0].EstimatedSavings; savings < int64(len(text))*9/10 {
+		t.Errorf("Expected a large estimated saving, got %d of %d", savings, len(text))
+	}
+
+	// The search offers its candidates for compression, not for deletion
+	for _, mode := range []CleanMode{CleanModeDelete, CleanModeTrash, CleanModeQuarantine} {
+		deleted := CleanFilesWithOptions([]FileInfo{report.Candidates[0].File}, CleanOptions{Mode: mode})
+		if deleted.CleanedCount != 0 || deleted.Items[0].Reason != SkipNotScanned {
+			t.Errorf("Expected a %s clean of a compress candidate to be skipped, got: %+v", mode, deleted.Items)
+		}
+	}
+	if _, err := os.Lstat(logPath); err != nil {
+		t.Fatalf("Expected the candidate to be left alone, got: %v", err)
+	}
+
+	cleaned := CleanFilesWithOptions([]FileInfo{report.Candidates[0].File}, CleanOptions{Mode: CleanModeCompress})
+	if cleaned.CleanedCount != 1 || cleaned.Items[0].Status != StatusCompressed {
+		t.Fatalf("Expected the log to be compressed, got: %+v", cleaned)
+	}
+	if _, err := os.Lstat(logPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the original to be removed, got: %v", err)
+	}
+
+	gzPath := logPath + ".gz"
+	info, err := os.Stat(gzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved := int64(len(text)) - info.Size(); cleaned.CleanedSize != saved {
+		t.Errorf("Expected %d bytes saved, got %d", saved, cleaned.CleanedSize)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("Expected the modification time to be kept, got %v", info.ModTime())
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640 to be kept, got %v", info.Mode().Perm())
+	}
+
+	f, err := os.Open(gzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil || !bytes.Equal(data, text) {
+		t.Errorf("Expected the archive to hold the original contents, got %d bytes: %v", len(data), err)
+	}
+
+	// A file that is compressed already is never compressed again
+	registerScannedFile(DirInfo{Path: root}, gzPath, info)
+	cleaned = CleanFilesWithOptions([]FileInfo{{Path: gzPath, Location: compressibleCategory}}, CleanOptions{Mode: CleanModeCompress})
+	if cleaned.SkippedCount != 1 || cleaned.Items[0].Reason != SkipNotCompressible {
+		t.Errorf("Expected the archive to be skipped, got: %+v", cleaned.Items)
+	}
+}
+
+func TestCompressFileNeverReplacesAnArchive(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "app.log")
+	writeTestFile(t, path, []byte(strings.Repeat("line\n", 1000)))
+	writeTestFile(t, path+".gz", []byte("existing"))
+
+	if _, err := compressFile(path); err == nil {
+		t.Fatalf("Expected compressing next to an existing archive to fail")
+	}
+	if data, err := os.ReadFile(path + ".gz"); err != nil || string(data) != "existing" {
+		t.Errorf("Expected the existing archive to be left alone, got %q (%v)", data, err)
+	}
+	if _, err := os.Lstat(path); err != nil {
+		t.Errorf("Expected the original to be kept: %v", err)
+	}
+
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 2 {
+		t.Errorf("Expected no temporary file to be left behind, got %d entries", len(entries))
+	}
+}
+
+func TestCompressFileWithoutHardLinks(t *testing.T) {
+	linkFile = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	defer func() { linkFile = os.Link }()
+
+	root := t.TempDir()
+	text := []byte(strings.Repeat("line\n", 1000))
+	path := filepath.Join(root, "app.log")
+	writeTestFile(t, path, text)
+
+	if _, err := compressFile(path); err != nil {
+		t.Fatalf("Expected compressing without hard links to work, got: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the original to be removed, got: %v", err)
+	}
+	f, err := os.Open(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(gz); err != nil || !bytes.Equal(data, text) {
+		t.Errorf("Expected the archive to hold the original contents, got %d bytes: %v", len(data), err)
+	}
+
+	// An existing archive is still never replaced
+	writeTestFile(t, path, text)
+	if _, err := compressFile(path); err == nil {
+		t.Errorf("Expected compressing next to an existing archive to fail")
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 2 {
+		t.Errorf("Expected no temporary file to be left behind, got %d entries", len(entries))
+	}
+}
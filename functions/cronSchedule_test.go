@@ -0,0 +1,42 @@
+package functions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 7, 30, 0, time.UTC) // a Wednesday
+
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 31, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 15, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, time.February, 1, 3, 0, 0, 0, time.UTC)},
+		{"30 2 * * 0", time.Date(2024, time.February, 4, 2, 30, 0, 0, time.UTC)},
+		{"30 2 * * 7", time.Date(2024, time.February, 4, 2, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1-5 * 1", time.Date(2024, time.February, 1, 12, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2024, time.January, 31, 10, 25, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, c := range cases {
+		schedule, err := parseCronSchedule(c.expr)
+		if err != nil {
+			t.Errorf("parseCronSchedule(%q): %v", c.expr, err)
+			continue
+		}
+		if got := schedule.next(from); !got.Equal(c.want) {
+			t.Errorf("next(%q) = %v, want %v", c.expr, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCronSchedule(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
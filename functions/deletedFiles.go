@@ -0,0 +1,175 @@
+package functions
+
+import (
+	"bufio"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const deletedSuffix = " (deleted)"
+
+// DeletedOpenFile is a file that was deleted while a process still had it open. Its
+// space is only freed once the last descriptor is closed.
+type DeletedOpenFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// DeletedFileHolder is a process holding deleted files open
+type DeletedFileHolder struct {
+	PID   int               `json:"pid"`
+	Name  string            `json:"name"`
+	User  string            `json:"user"`
+	Files []DeletedOpenFile `json:"files"`
+	// Size is the space held by this process's deleted files
+	Size int64 `json:"size"`
+}
+
+// DeletedFilesReport totals the space held by deleted but open files
+type DeletedFilesReport struct {
+	Processes []DeletedFileHolder `json:"processes"`
+	// TotalSize counts each file once, even if several processes hold it
+	TotalSize int64 `json:"totalSize"`
+	// Supported is false where /proc can't be read (any OS but Linux)
+	Supported bool `json:"supported"`
+}
+
+// FindDeletedOpenFiles walks /proc/*/fd for descriptors of deleted files, biggest
+// holders first. Processes of other users are only visible when running elevated.
+func FindDeletedOpenFiles() DeletedFilesReport {
+	return findDeletedOpenFiles(nil)
+}
+
+// findDeletedOpenFiles is FindDeletedOpenFiles limited to the files match accepts
+func findDeletedOpenFiles(match func(path string) bool) DeletedFilesReport {
+	report := DeletedFilesReport{Processes: []DeletedFileHolder{}}
+	if runtime.GOOS != "linux" {
+		return report
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return report
+	}
+	report.Supported = true
+
+	counted := map[fileIdentity]bool{}
+	users := map[string]string{}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		procDir := filepath.Join("/proc", proc.Name())
+
+		fds, err := os.ReadDir(filepath.Join(procDir, "fd"))
+		if err != nil {
+			continue
+		}
+
+		holder := DeletedFileHolder{PID: pid, Files: []DeletedOpenFile{}}
+		seen := map[fileIdentity]bool{}
+		for _, fd := range fds {
+			fdPath := filepath.Join(procDir, "fd", fd.Name())
+			target, err := os.Readlink(fdPath)
+			if err != nil || !strings.HasSuffix(target, deletedSuffix) {
+				continue
+			}
+			path := strings.TrimSuffix(target, deletedSuffix)
+			// memfd and SysV shared memory never were on a filesystem
+			if !filepath.IsAbs(path) || strings.HasPrefix(path, "/memfd:") || strings.HasPrefix(path, "/SYSV") {
+				continue
+			}
+			if match != nil && !match(path) {
+				continue
+			}
+
+			// Stat follows the descriptor to the unlinked inode itself
+			info, err := os.Stat(fdPath)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			id, ok := identityOf(fdPath, info)
+			if ok && seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			holder.Files = append(holder.Files, DeletedOpenFile{Path: path, Size: info.Size()})
+			holder.Size += info.Size()
+			if !ok || !counted[id] {
+				counted[id] = true
+				report.TotalSize += info.Size()
+			}
+		}
+
+		if len(holder.Files) == 0 {
+			continue
+		}
+		holder.Name = processName(procDir)
+		holder.User = processUser(procDir, users)
+		sort.Slice(holder.Files, func(i, j int) bool { return holder.Files[i].Size > holder.Files[j].Size })
+		report.Processes = append(report.Processes, holder)
+	}
+
+	sort.Slice(report.Processes, func(i, j int) bool { return report.Processes[i].Size > report.Processes[j].Size })
+	return report
+}
+
+// processUser returns the name of the real user of a process, caching lookups by uid
+func processUser(procDir string, cache map[string]string) string {
+	f, err := os.Open(filepath.Join(procDir, "status"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "Uid:" {
+			continue
+		}
+
+		uid := fields[1]
+		if name, exists := cache[uid]; exists {
+			return name
+		}
+		name := uid
+		if u, err := user.LookupId(uid); err == nil {
+			name = u.Username
+		}
+		cache[uid] = name
+		return name
+	}
+	return ""
+}
+
+// heldOpenAfterClean returns the processes still holding files that report removed
+// (compressed files count too: the original is gone)
+func heldOpenAfterClean(report *CleanReport) DeletedFilesReport {
+	var removed []string
+	for _, item := range report.Items {
+		if item.Status == StatusRemoved || item.Status == StatusCompressed {
+			removed = append(removed, item.Path)
+		}
+	}
+	if len(removed) == 0 || runtime.GOOS != "linux" {
+		return DeletedFilesReport{Processes: []DeletedFileHolder{}}
+	}
+
+	return findDeletedOpenFiles(func(path string) bool {
+		for _, root := range removed {
+			if isWithin(root, path) {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,42 @@
+package functions
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHeldOpenAfterClean(t *testing.T) {
+	useTempAppData(t)
+
+	if !FindDeletedOpenFiles().Supported {
+		t.Skip("/proc is not available")
+	}
+
+	path := writeScannedFile(t, t.TempDir(), "held.log", make([]byte, 4096)).Path
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report := CleanFilesWithOptions([]FileInfo{{Path: path, Size: 4096, Location: "Logs"}}, CleanOptions{AllowOpenFiles: true})
+	if report.CleanedCount != 1 {
+		t.Fatalf("Expected the open file to be removed, got: %+v", report)
+	}
+	if report.HeldOpenSize != 4096 || len(report.HeldOpen) != 1 || report.HeldOpen[0].PID != os.Getpid() {
+		t.Fatalf("Expected this process to hold 4096 bytes, got %d: %+v", report.HeldOpenSize, report.HeldOpen)
+	}
+	if files := report.HeldOpen[0].Files; len(files) != 1 || files[0].Path != path {
+		t.Errorf("Expected %s to be reported, got: %+v", path, files)
+	}
+
+	f.Close()
+	for _, holder := range FindDeletedOpenFiles().Processes {
+		for _, file := range holder.Files {
+			if file.Path == path {
+				t.Errorf("Expected %s to be gone once closed", path)
+			}
+		}
+	}
+}
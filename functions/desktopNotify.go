@@ -0,0 +1,46 @@
+package functions
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Windows only shows toasts of registered apps, so they go out as PowerShell's
+const powershellAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// The title and message reach the toast through the environment, never the script
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$toast = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $toast.GetElementsByTagName('text')
+$text.Item(0).AppendChild($toast.CreateTextNode($env:NOTIFY_TITLE)) > $null
+$text.Item(1).AppendChild($toast.CreateTextNode($env:NOTIFY_MESSAGE)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($env:NOTIFY_APP).Show([Windows.UI.Notifications.ToastNotification]::new($toast))`
+
+// sendDesktopNotification shows a notification through the desktop's own service,
+// for when there is no window to show it in
+func sendDesktopNotification(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("notify-send", "--app-name=SysInfo Pro", title, message)
+	case "darwin":
+		// Arguments after the script go to its run handler unquoted
+		cmd = exec.Command("osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, message)
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+		cmd.Env = append(os.Environ(), "NOTIFY_TITLE="+title, "NOTIFY_MESSAGE="+message, "NOTIFY_APP="+powershellAppID)
+	default:
+		return fmt.Errorf("desktop notifications aren't supported on %s", runtime.GOOS)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error sending desktop notification: %w: %s", err, output)
+	}
+	return nil
+}
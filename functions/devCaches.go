@@ -0,0 +1,261 @@
+package functions
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Each provider below finds a developer tool's cache the same way the tool itself
+// does: its environment variable first, then its config file, then its default.
+
+func goBuildCacheDirs() []string {
+	cache := goEnv("GOCACHE")
+	if cache == "off" {
+		return nil
+	}
+	if cache == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil
+		}
+		cache = filepath.Join(base, "go-build")
+	}
+	return []string{cache}
+}
+
+func goModuleCacheDirs() []string {
+	if cache := goEnv("GOMODCACHE"); cache != "" {
+		return []string{cache}
+	}
+
+	gopath := goEnv("GOPATH")
+	if gopath == "" {
+		home := userHomeDir()
+		if home == "" {
+			return nil
+		}
+		gopath = filepath.Join(home, "go")
+	}
+
+	// Like the go command, only the first GOPATH entry holds the module cache
+	gopath = filepath.SplitList(gopath)[0]
+	return []string{filepath.Join(gopath, "pkg", "mod")}
+}
+
+// goEnv reads a Go setting from the environment or from the file written by `go env -w`
+func goEnv(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	envFile := os.Getenv("GOENV")
+	if envFile == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return ""
+		}
+		envFile = filepath.Join(configDir, "go", "env")
+	}
+	if envFile == "off" {
+		return ""
+	}
+
+	return readKeyValueFile(envFile, name)
+}
+
+func npmCacheDirs() []string {
+	for _, name := range []string{"npm_config_cache", "NPM_CONFIG_CACHE"} {
+		if value := os.Getenv(name); value != "" {
+			return []string{value}
+		}
+	}
+
+	home := userHomeDir()
+	if home == "" {
+		return nil
+	}
+
+	// A cache set in the user's .npmrc takes precedence over the default
+	if cache := readKeyValueFile(filepath.Join(home, ".npmrc"), "cache"); cache != "" {
+		if strings.HasPrefix(cache, "~/") {
+			cache = filepath.Join(home, cache[2:])
+		}
+		return []string{cache}
+	}
+
+	if runtime.GOOS == "windows" {
+		return []string{filepath.Join(os.Getenv("LOCALAPPDATA"), "npm-cache")}
+	}
+	return []string{filepath.Join(home, ".npm")}
+}
+
+func yarnCacheDirs() []string {
+	if value := os.Getenv("YARN_CACHE_FOLDER"); value != "" {
+		return []string{value}
+	}
+
+	home := userHomeDir()
+	if home == "" {
+		return nil
+	}
+
+	// Yarn 2+ keeps a shared cache under ~/.yarn/berry
+	dirs := []string{filepath.Join(home, ".yarn", "berry", "cache")}
+
+	switch runtime.GOOS {
+	case "windows":
+		dirs = append(dirs, filepath.Join(os.Getenv("LOCALAPPDATA"), "Yarn", "Cache"))
+	case "darwin":
+		dirs = append(dirs, filepath.Join(home, "Library", "Caches", "Yarn"))
+	default:
+		dirs = append(dirs, filepath.Join(rulePathVar("XDG_CACHE_HOME"), "yarn"))
+	}
+	return dirs
+}
+
+func pnpmStoreDirs() []string {
+	for _, name := range []string{"npm_config_store_dir", "PNPM_STORE_DIR"} {
+		if value := os.Getenv(name); value != "" {
+			return []string{value}
+		}
+	}
+
+	home := userHomeDir()
+	if home == "" {
+		return nil
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return []string{filepath.Join(os.Getenv("LOCALAPPDATA"), "pnpm", "store")}
+	case "darwin":
+		return []string{filepath.Join(home, "Library", "pnpm", "store")}
+	default:
+		return []string{filepath.Join(rulePathVar("XDG_DATA_HOME"), "pnpm", "store")}
+	}
+}
+
+func pipCacheDirs() []string {
+	if os.Getenv("PIP_NO_CACHE_DIR") != "" {
+		return nil
+	}
+	if value := os.Getenv("PIP_CACHE_DIR"); value != "" {
+		return []string{value}
+	}
+
+	home := userHomeDir()
+	if home == "" {
+		return nil
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return []string{filepath.Join(os.Getenv("LOCALAPPDATA"), "pip", "Cache")}
+	case "darwin":
+		return []string{filepath.Join(home, "Library", "Caches", "pip")}
+	default:
+		return []string{filepath.Join(rulePathVar("XDG_CACHE_HOME"), "pip")}
+	}
+}
+
+func cargoCacheDirs() []string {
+	cargoHome := os.Getenv("CARGO_HOME")
+	if cargoHome == "" {
+		home := userHomeDir()
+		if home == "" {
+			return nil
+		}
+		cargoHome = filepath.Join(home, ".cargo")
+	}
+
+	// Only the downloaded crates and checkouts; bin/ holds installed tools
+	return []string{
+		filepath.Join(cargoHome, "registry", "cache"),
+		filepath.Join(cargoHome, "registry", "src"),
+		filepath.Join(cargoHome, "git", "checkouts"),
+	}
+}
+
+func mavenRepositoryDirs() []string {
+	home := userHomeDir()
+	if home == "" {
+		return nil
+	}
+
+	// localRepository in settings.xml moves the repository
+	settings := struct {
+		LocalRepository string `xml:"localRepository"`
+	}{}
+	if data, err := os.ReadFile(filepath.Join(home, ".m2", "settings.xml")); err == nil {
+		if xml.Unmarshal(data, &settings) == nil && strings.TrimSpace(settings.LocalRepository) != "" {
+			repo := strings.TrimSpace(settings.LocalRepository)
+			repo = strings.ReplaceAll(repo, "${user.home}", home)
+			return []string{repo}
+		}
+	}
+
+	return []string{filepath.Join(home, ".m2", "repository")}
+}
+
+func gradleCacheDirs() []string {
+	gradleHome := os.Getenv("GRADLE_USER_HOME")
+	if gradleHome == "" {
+		home := userHomeDir()
+		if home == "" {
+			return nil
+		}
+		gradleHome = filepath.Join(home, ".gradle")
+	}
+	return []string{filepath.Join(gradleHome, "caches")}
+}
+
+// readKeyValueFile returns the value of key in a simple "key=value" file such as
+// .npmrc or Go's env file. Missing files and keys return an empty string.
+func readKeyValueFile(path, key string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		name, value, found := strings.Cut(line, "=")
+		if found && strings.TrimSpace(name) == key {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// makeTreeWritable adds owner write permission to every directory below path so
+// that read-only trees, like the Go module cache, can be removed
+func makeTreeWritable(path string) error {
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.Mode().Perm()&0200 == 0 {
+			return os.Chmod(p, info.Mode().Perm()|0200)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,144 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDevCacheProviders(t *testing.T) {
+	cases := []struct {
+		name     string
+		provider func() []string
+		env      map[string]string
+		// files are written below the home directory before the provider runs
+		files map[string]string
+		// want uses ~ for the home directory
+		want      []string
+		linuxOnly bool
+	}{
+		{"GOCACHE", goBuildCacheDirs, map[string]string{"GOCACHE": "/cache/go"}, nil, []string{"/cache/go"}, false},
+		{"GOCACHE off", goBuildCacheDirs, map[string]string{"GOCACHE": "off"}, nil, nil, false},
+		{"go build default", goBuildCacheDirs, nil, nil, []string{"~/.cache/go-build"}, true},
+		{"GOMODCACHE", goModuleCacheDirs, map[string]string{"GOMODCACHE": "/cache/mod"}, nil, []string{"/cache/mod"}, false},
+		{"first GOPATH entry", goModuleCacheDirs, map[string]string{"GOPATH": "/one" + string(os.PathListSeparator) + "/two"}, nil, []string{"/one/pkg/mod"}, false},
+		{"go env file", goModuleCacheDirs, map[string]string{"GOENV": "~/goenv"}, map[string]string{"goenv": "GOMODCACHE=/from/env\n"}, []string{"/from/env"}, false},
+		{"GOPATH default", goModuleCacheDirs, nil, nil, []string{"~/go/pkg/mod"}, false},
+		{"npm env", npmCacheDirs, map[string]string{"npm_config_cache": "/cache/npm"}, nil, []string{"/cache/npm"}, false},
+		{"npmrc", npmCacheDirs, nil, map[string]string{".npmrc": "; comment\ncache = ~/npm-cache\n"}, []string{"~/npm-cache"}, false},
+		{"npm default", npmCacheDirs, nil, nil, []string{"~/.npm"}, true},
+		{"YARN_CACHE_FOLDER", yarnCacheDirs, map[string]string{"YARN_CACHE_FOLDER": "/cache/yarn"}, nil, []string{"/cache/yarn"}, false},
+		{"yarn default", yarnCacheDirs, nil, nil, []string{"~/.yarn/berry/cache", "~/.cache/yarn"}, true},
+		{"pnpm env", pnpmStoreDirs, map[string]string{"PNPM_STORE_DIR": "/store"}, nil, []string{"/store"}, false},
+		{"pnpm default", pnpmStoreDirs, nil, nil, []string{"~/.local/share/pnpm/store"}, true},
+		{"PIP_NO_CACHE_DIR", pipCacheDirs, map[string]string{"PIP_NO_CACHE_DIR": "1", "PIP_CACHE_DIR": "/cache/pip"}, nil, nil, false},
+		{"PIP_CACHE_DIR", pipCacheDirs, map[string]string{"PIP_CACHE_DIR": "/cache/pip"}, nil, []string{"/cache/pip"}, false},
+		{"pip default", pipCacheDirs, nil, nil, []string{"~/.cache/pip"}, true},
+		{"CARGO_HOME", cargoCacheDirs, map[string]string{"CARGO_HOME": "/cargo"}, nil, []string{"/cargo/registry/cache", "/cargo/registry/src", "/cargo/git/checkouts"}, false},
+		{"maven settings", mavenRepositoryDirs, nil, map[string]string{".m2/settings.xml": "<settings><localRepository>${user.home}/repo</localRepository></settings>"}, []string{"~/repo"}, false},
+		{"maven default", mavenRepositoryDirs, nil, nil, []string{"~/.m2/repository"}, false},
+		{"GRADLE_USER_HOME", gradleCacheDirs, map[string]string{"GRADLE_USER_HOME": "/gradle"}, nil, []string{"/gradle/caches"}, false},
+		{"gradle default", gradleCacheDirs, nil, nil, []string{"~/.gradle/caches"}, false},
+	}
+
+	variables := []string{
+		"GOCACHE", "GOMODCACHE", "GOPATH", "GOENV", "npm_config_cache", "NPM_CONFIG_CACHE",
+		"YARN_CACHE_FOLDER", "npm_config_store_dir", "PNPM_STORE_DIR", "PIP_NO_CACHE_DIR",
+		"PIP_CACHE_DIR", "CARGO_HOME", "GRADLE_USER_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME",
+		"XDG_CONFIG_HOME",
+	}
+
+	for _, c := range cases {
+		if c.linuxOnly && runtime.GOOS != "linux" {
+			continue
+		}
+		t.Run(c.name, func(t *testing.T) {
+			home := t.TempDir()
+			expand := func(path string) string {
+				if strings.HasPrefix(path, "~/") {
+					path = filepath.Join(home, path[2:])
+				}
+				return filepath.FromSlash(path)
+			}
+
+			t.Setenv("HOME", home)
+			t.Setenv("USERPROFILE", home)
+			for _, name := range variables {
+				t.Setenv(name, "")
+			}
+			for name, value := range c.env {
+				t.Setenv(name, expand(value))
+			}
+			for rel, data := range c.files {
+				path := filepath.Join(home, filepath.FromSlash(rel))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var want []string
+			for _, path := range c.want {
+				want = append(want, expand(path))
+			}
+			got := c.provider()
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMakeTreeWritable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions don't block removal on Windows")
+	}
+
+	root := filepath.Join(t.TempDir(), "mod")
+	for _, dir := range []string{"a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "b", "file.go"), []byte("package b"), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read-only like the module cache, deepest first so the walk can still get in
+	modes := []struct {
+		rel  string
+		mode os.FileMode
+	}{
+		{"a/b", 0555},
+		{"a", 0555},
+		{"c", 0500},
+		{".", 0555},
+	}
+	for _, m := range modes {
+		os.Chmod(filepath.Join(root, filepath.FromSlash(m.rel)), m.mode)
+	}
+	t.Cleanup(func() { makeTreeWritable(root) })
+
+	if err := makeTreeWritable(root); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range modes {
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(m.rel)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != m.mode|0200 {
+			t.Errorf("%s: got mode %v, want %v", m.rel, got, m.mode|0200)
+		}
+	}
+
+	// Files keep their mode; only the directories have to be writable
+	if info, _ := os.Stat(filepath.Join(root, "a", "b", "file.go")); info.Mode().Perm() != 0444 {
+		t.Errorf("Expected file.go to stay read-only, got %v", info.Mode().Perm())
+	}
+	if err := os.RemoveAll(root); err != nil {
+		t.Errorf("Expected the tree to be removable: %v", err)
+	}
+}
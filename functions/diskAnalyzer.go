@@ -0,0 +1,416 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// filesPerDir is how many of a directory's largest files are kept as tree nodes;
+	// smaller files are folded into one "other files" node
+	filesPerDir         = 16
+	defaultAnalyzeDepth = 2
+	defaultAnalyzeTopN  = 20
+	maxUnreadablePaths  = 100
+)
+
+// DiskUsageNode is one file or directory of a disk usage tree. A directory's
+// smaller files are folded into a single node marked Other, which has no path.
+type DiskUsageNode struct {
+	Name      string           `json:"name"`
+	Path      string           `json:"path"`
+	Size      int64            `json:"size"`
+	FileCount int64            `json:"fileCount"`
+	IsDir     bool             `json:"isDir"`
+	HasMore   bool             `json:"hasMore"`
+	Other     bool             `json:"other,omitempty"`
+	Children  []*DiskUsageNode `json:"children,omitempty"`
+}
+
+// DiskUsageEntry is a file or directory in a top-N list
+type DiskUsageEntry struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	IsDir bool   `json:"isDir"`
+}
+
+// DiskAnalysisOptions configures AnalyzeDiskUsage
+type DiskAnalysisOptions struct {
+	Depth int `json:"depth"`
+	TopN  int `json:"topN"`
+}
+
+// DiskAnalysis is the result of AnalyzeDiskUsage
+type DiskAnalysis struct {
+	Root         *DiskUsageNode   `json:"root"`
+	LargestFiles []DiskUsageEntry `json:"largestFiles"`
+	LargestDirs  []DiskUsageEntry `json:"largestDirs"`
+	TotalSize    int64            `json:"totalSize"`
+	FileCount    int64            `json:"fileCount"`
+	DirCount     int64            `json:"dirCount"`
+	Unreadable   []string         `json:"unreadable"`
+	Duration     float64          `json:"durationSeconds"`
+}
+
+// diskNode is the in-memory tree kept for drill-down
+type diskNode struct {
+	name      string
+	size      int64
+	fileCount int64
+	isDir     bool
+	children  []*diskNode
+	// otherSize and otherCount cover the files not kept as children
+	otherSize  int64
+	otherCount int64
+}
+
+// lastAnalysis keeps the most recent tree so GetDiskUsageNode can drill down
+// without walking the disk again
+var lastAnalysis struct {
+	sync.Mutex
+	root string
+	tree *diskNode
+}
+
+// AnalyzeDiskUsage walks root concurrently and returns its size tree down to
+// options.Depth, plus the largest files and directories found
+func AnalyzeDiskUsage(ctx context.Context, root string, options DiskAnalysisOptions, progress ScanProgressFunc) (*DiskAnalysis, error) {
+	if root == "" {
+		root = defaultAnalyzeRoot()
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if isProtectedPath(root) {
+		return nil, fmt.Errorf("refusing to analyze protected path: %s", root)
+	}
+	if !hasReadPermission(root) {
+		return nil, fmt.Errorf("cannot read %s", root)
+	}
+
+	if options.Depth <= 0 {
+		options.Depth = defaultAnalyzeDepth
+	}
+	if options.TopN <= 0 {
+		options.TopN = defaultAnalyzeTopN
+	}
+
+	rootInfo, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	walker := &diskWalker{
+		scanner: newCleanerScanner(ctx, progress),
+		topN:    options.TopN,
+		linked:  map[fileIdentity]bool{},
+	}
+	walker.device, walker.deviceKnown = deviceOf(rootInfo)
+
+	tree := &diskNode{name: filepath.Base(root), isDir: true}
+	walker.walk(root, tree)
+	walker.scanner.report("", true)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	lastAnalysis.Lock()
+	lastAnalysis.root = root
+	lastAnalysis.tree = tree
+	lastAnalysis.Unlock()
+
+	analysis := &DiskAnalysis{
+		Root:         tree.view(root, options.Depth),
+		LargestFiles: walker.largestFiles,
+		LargestDirs:  largestDirs(root, tree, options.TopN),
+		TotalSize:    tree.size,
+		FileCount:    tree.fileCount,
+		DirCount:     walker.dirCount.Load(),
+		Unreadable:   walker.unreadable,
+		Duration:     time.Since(start).Seconds(),
+	}
+	if analysis.LargestFiles == nil {
+		analysis.LargestFiles = []DiskUsageEntry{}
+	}
+	if analysis.Unreadable == nil {
+		analysis.Unreadable = []string{}
+	}
+
+	return analysis, nil
+}
+
+// GetDiskUsageNode returns a subtree of the last analysis, down to depth levels
+func GetDiskUsageNode(path string, depth int) (*DiskUsageNode, error) {
+	lastAnalysis.Lock()
+	defer lastAnalysis.Unlock()
+
+	if lastAnalysis.tree == nil {
+		return nil, errors.New("no disk analysis has been run")
+	}
+	if depth <= 0 {
+		depth = defaultAnalyzeDepth
+	}
+
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(lastAnalysis.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is not part of the last analysis", path)
+	}
+
+	node := lastAnalysis.tree
+	if rel != "." {
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			node = node.child(name)
+			if node == nil {
+				return nil, fmt.Errorf("%s is not part of the last analysis", path)
+			}
+		}
+	}
+
+	return node.view(path, depth), nil
+}
+
+type diskWalker struct {
+	scanner *cleanerScanner
+	topN    int
+
+	// Other filesystems mounted below the root aren't part of its usage
+	device      uint64
+	deviceKnown bool
+
+	dirCount atomic.Int64
+
+	mu           sync.Mutex
+	largestFiles []DiskUsageEntry
+	unreadable   []string
+	// linked holds the hardlinked files counted so far, so each is counted once
+	linked map[fileIdentity]bool
+}
+
+// walk fills node with the contents of path. Like cleanerScanner.dirSize,
+// subdirectories go to a free worker or are walked inline.
+func (w *diskWalker) walk(path string, node *diskNode) {
+	s := w.scanner
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		w.addUnreadable(path)
+		return
+	}
+
+	w.dirCount.Add(1)
+	s.report(path, false)
+
+	var wg sync.WaitGroup
+	var files []*diskNode
+
+	for _, entry := range entries {
+		if s.ctx.Err() != nil {
+			break
+		}
+
+		childPath := filepath.Join(path, entry.Name())
+
+		// Never wander into /proc, /sys and the like, or the user's exclusions
+		if isProtectedPath(childPath) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !sameDevice(info, w.device, w.deviceKnown) {
+			continue
+		}
+
+		if entry.IsDir() {
+			child := &diskNode{name: entry.Name(), isDir: true}
+			node.children = append(node.children, child)
+
+			select {
+			case s.workers <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-s.workers }()
+					w.walk(childPath, child)
+				}()
+			default:
+				w.walk(childPath, child)
+			}
+			continue
+		}
+
+		if isHardlinked(info) && !w.firstLink(childPath, info) {
+			continue
+		}
+
+		files = append(files, &diskNode{name: entry.Name(), size: info.Size(), fileCount: 1})
+		w.addFile(childPath, info.Size())
+		s.filesCounted.Add(1)
+		s.bytesFound.Add(info.Size())
+	}
+
+	wg.Wait()
+
+	// Keep only the largest files as nodes
+	sort.Slice(files, func(i, j int) bool { return files[i].size > files[j].size })
+	for i, file := range files {
+		if i < filesPerDir {
+			node.children = append(node.children, file)
+		} else {
+			node.otherSize += file.size
+			node.otherCount++
+		}
+	}
+
+	for _, child := range node.children {
+		node.size += child.size
+		node.fileCount += child.fileCount
+	}
+	node.size += node.otherSize
+	node.fileCount += node.otherCount
+
+	sort.Slice(node.children, func(i, j int) bool { return node.children[i].size > node.children[j].size })
+}
+
+func (w *diskWalker) addFile(path string, size int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.largestFiles) == w.topN && size <= w.largestFiles[w.topN-1].Size {
+		return
+	}
+
+	entry := DiskUsageEntry{Path: path, Size: size}
+	i := sort.Search(len(w.largestFiles), func(i int) bool { return w.largestFiles[i].Size < size })
+	w.largestFiles = append(w.largestFiles, DiskUsageEntry{})
+	copy(w.largestFiles[i+1:], w.largestFiles[i:])
+	w.largestFiles[i] = entry
+
+	if len(w.largestFiles) > w.topN {
+		w.largestFiles = w.largestFiles[:w.topN]
+	}
+}
+
+// firstLink reports whether a hardlinked file is seen for the first time
+func (w *diskWalker) firstLink(path string, info os.FileInfo) bool {
+	identity, ok := identityOf(path, info)
+	if !ok {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.linked[identity] {
+		return false
+	}
+	w.linked[identity] = true
+	return true
+}
+
+func (w *diskWalker) addUnreadable(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.unreadable) < maxUnreadablePaths {
+		w.unreadable = append(w.unreadable, path)
+	}
+}
+
+func (n *diskNode) child(name string) *diskNode {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// view converts the node into its public form, cut off depth levels down
+func (n *diskNode) view(path string, depth int) *DiskUsageNode {
+	view := &DiskUsageNode{
+		Name:      n.name,
+		Path:      path,
+		Size:      n.size,
+		FileCount: n.fileCount,
+		IsDir:     n.isDir,
+	}
+
+	if !n.isDir {
+		return view
+	}
+
+	if depth <= 0 {
+		view.HasMore = len(n.children) > 0 || n.otherCount > 0
+		return view
+	}
+
+	for _, child := range n.children {
+		view.Children = append(view.Children, child.view(filepath.Join(path, child.name), depth-1))
+	}
+
+	if n.otherCount > 0 {
+		view.Children = append(view.Children, &DiskUsageNode{
+			Name:      fmt.Sprintf("%d other files", n.otherCount),
+			Size:      n.otherSize,
+			FileCount: n.otherCount,
+			Other:     true,
+		})
+	}
+
+	return view
+}
+
+// largestDirs returns the topN largest directories below root
+func largestDirs(root string, tree *diskNode, topN int) []DiskUsageEntry {
+	var dirs []DiskUsageEntry
+
+	var collect func(path string, node *diskNode)
+	collect = func(path string, node *diskNode) {
+		for _, child := range node.children {
+			if !child.isDir {
+				continue
+			}
+			childPath := filepath.Join(path, child.name)
+			dirs = append(dirs, DiskUsageEntry{Path: childPath, Size: child.size, IsDir: true})
+			collect(childPath, child)
+		}
+	}
+	collect(root, tree)
+
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Size > dirs[j].Size })
+	if len(dirs) > topN {
+		dirs = dirs[:topN]
+	}
+	if dirs == nil {
+		dirs = []DiskUsageEntry{}
+	}
+	return dirs
+}
+
+// defaultAnalyzeRoot is used when no root is given: the user's home directory, or the system drive on Windows
+func defaultAnalyzeRoot() string {
+	if runtime.GOOS == "windows" {
+		if drive := os.Getenv("SystemDrive"); drive != "" {
+			return drive + `\`
+		}
+	}
+	return userHomeDir()
+}
@@ -0,0 +1,94 @@
+package functions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestAnalyzeDiskUsage(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel string, size int) string {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	big := write("media/big.bin", 10000)
+	for i := 0; i < filesPerDir+4; i++ {
+		write(fmt.Sprintf("logs/%02d.log", i), 100)
+	}
+
+	// Hardlinks take the space once
+	linked := runtime.GOOS != "windows" && os.Link(big, filepath.Join(root, "media", "link.bin")) == nil
+
+	analysis, err := AnalyzeDiskUsage(context.Background(), root, DiskAnalysisOptions{Depth: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := int64(10000 + (filesPerDir+4)*100)
+	if analysis.TotalSize != want {
+		t.Errorf("Expected %d bytes, got %d (hardlinked: %v)", want, analysis.TotalSize, linked)
+	}
+
+	var logs *DiskUsageNode
+	for _, child := range analysis.Root.Children {
+		if child.Name == "logs" {
+			logs = child
+		}
+	}
+	if logs == nil {
+		t.Fatalf("Expected a logs node, got: %+v", analysis.Root.Children)
+	}
+	other := logs.Children[len(logs.Children)-1]
+	if !other.Other || other.Path != "" || other.FileCount != 4 || other.Size != 400 {
+		t.Errorf("Expected a pathless node for the 4 smallest files, got: %+v", other)
+	}
+
+	node, err := GetDiskUsageNode(filepath.Join(root, "media"), 1)
+	if err != nil || node.Size != 10000 {
+		t.Errorf("Expected to drill down into media, got: %+v (%v)", node, err)
+	}
+}
+
+func TestDiskWalkerStaysOnItsDevice(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "mounted"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "mounted", "data"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, known := deviceOf(info)
+	if !known {
+		t.Skip("devices are not known on this OS")
+	}
+
+	// Everything in root looks like it is on another filesystem
+	walker := &diskWalker{
+		scanner:     newCleanerScanner(context.Background(), nil),
+		topN:        defaultAnalyzeTopN,
+		device:      device + 1,
+		deviceKnown: true,
+		linked:      map[fileIdentity]bool{},
+	}
+	tree := &diskNode{name: filepath.Base(root), isDir: true}
+	walker.walk(root, tree)
+
+	if tree.size != 0 || len(tree.children) != 0 {
+		t.Errorf("Expected nothing from another device, got %d bytes in %d children", tree.size, len(tree.children))
+	}
+}
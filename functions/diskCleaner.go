@@ -1,6 +1,7 @@
 package functions
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -17,6 +18,9 @@ type PermissionStatus struct {
 	ElevationCommand    string
 	CanCleanUserFiles   bool
 	CanCleanSystemFiles bool
+	// HelperAvailable means files needing root can be cleaned through the clean
+	// helper without restarting the app elevated
+	HelperAvailable bool
 }
 
 // FileInfo represents information about a file/folder that can be cleaned
@@ -26,33 +30,99 @@ type FileInfo struct {
 	Name           string
 	Location       string
 	NeedsElevation bool
+	RuleID         string
+	FileID         string
+	// Profile is the browser profile a browser cache entry belongs to
+	Profile string
+	// Truncate empties the file instead of removing it (live logs)
+	Truncate bool
+
+	// OriginalPath is where a Trash entry was deleted from, the source of a thumbnail
+	// or the folder of an orphaned editor workspace
+	OriginalPath string
+	DeletedAt    time.Time
 }
 
 // CleanerResult represents the result of scanning the system
 type CleanerResult struct {
-	Files       map[string][]FileInfo
-	TotalSize   int64
-	Permissions PermissionStatus
+	Files         map[string][]FileInfo
+	CategorySizes map[string]int64
+	TotalSize     int64
+	Permissions   PermissionStatus
+	Skipped       []SkippedFile
+	// JournalUsage is the space taken by the systemd journal (Linux only)
+	JournalUsage int64
+	// Thumbnails sums up each subfolder of the thumbnail cache
+	Thumbnails []ThumbnailFolderUsage
+	// PackageCaches sums up the cache of each package manager (Linux only)
+	PackageCaches []PackageCacheUsage
+	// DeletedOpenFiles is the space held by deleted files that are still open (Linux only)
+	DeletedOpenFiles DeletedFilesReport
+}
+
+// SkippedFile is an entry a scan found but did not offer for cleaning
+type SkippedFile struct {
+	File     FileInfo
+	Reason   SkipReason
+	OpenedBy []ProcessRef
+	// ProtectedBy is the protection rule that excluded the file, if any
+	ProtectedBy *ProtectionRule
 }
 
 // GetCleanableFiles scans the system for files that can be cleaned
 func GetCleanableFiles() CleanerResult {
+	result, _ := GetCleanableFilesContext(context.Background(), nil)
+	return result
+}
+
+// GetCleanableFilesContext scans the system for files that can be cleaned, reporting
+// progress as it goes. If ctx is cancelled the partial result is returned with ctx's error.
+func GetCleanableFilesContext(ctx context.Context, progress ScanProgressFunc) (CleanerResult, error) {
+	return GetCleanableFilesWithOptions(ctx, ScanOptions{}, progress)
+}
+
+// GetCleanableFilesWithOptions is GetCleanableFilesContext with control over the
+// scan cache. Directories unchanged since the last scan aren't walked again.
+func GetCleanableFilesWithOptions(ctx context.Context, options ScanOptions, progress ScanProgressFunc) (CleanerResult, error) {
+	// Entries of an earlier scan can't be cleaned anymore
+	resetScannedFiles(scopeCleaner)
+	scanner := newCleanerScanner(ctx, progress)
+	scanner.openFiles = buildOpenFileIndex()
+	scanner.cache = openScanCache(options.ForceRescan)
+	defer scanner.cache.save()
+
 	result := CleanerResult{
-		Files:       make(map[string][]FileInfo),
-		TotalSize:   0,
-		Permissions: CheckPermissions(),
+		Files:         make(map[string][]FileInfo),
+		CategorySizes: make(map[string]int64),
+		TotalSize:     0,
+		Permissions:   checkPermissions(),
 	}
 
-	// Get standard temp directories
-	tempDirs := getSystemTempDirs()
+	// Directories come from the cleaner rules for this OS
+	allDirs := cleanerDirs(loadCleanerRulesOrDefault())
 
-	// Add browser cache directories
-	browserDirs := getBrowserCacheDirs()
+	if runtime.GOOS == "linux" {
+		result.JournalUsage = JournalDiskUsage()
+		result.DeletedOpenFiles = FindDeletedOpenFiles()
+	}
+
+	scanner.scanRoots(&result, allDirs)
 
-	// Combine all directories to scan
-	allDirs := append(tempDirs, browserDirs...)
+	result.Skipped = scanner.skippedFiles()
+	result.Thumbnails = scanner.thumbnailUsage()
+	scanner.report("", true)
+	return result, ctx.Err()
+}
+
+// scanRoots scans each cleanable directory into result. Directories that need root
+// are skipped unless the app runs elevated, or the clean helper can remove what is
+// found in them and they can be listed without root.
+func (s *cleanerScanner) scanRoots(result *CleanerResult, dirs []DirInfo) {
+	for _, dirInfo := range dirs {
+		if s.ctx.Err() != nil {
+			break
+		}
 
-	for _, dirInfo := range allDirs {
 		dirPath := dirInfo.Path
 		dirCategory := dirInfo.Location
 
@@ -60,75 +130,174 @@ func GetCleanableFiles() CleanerResult {
 			result.Files[dirCategory] = []FileInfo{}
 		}
 
-		needsElevation := needsElevatedPermissions(dirPath)
+		needsElevation := dirInfo.NeedsElevation
+		throughHelper := result.Permissions.HelperAvailable && hasReadPermission(dirPath)
 
 		// Skip directories that need elevation if we don't have it
-		if needsElevation && !result.Permissions.IsElevated {
+		if needsElevation && !result.Permissions.IsElevated && !throughHelper {
 			result.Permissions.UnaccessiblePaths = append(result.Permissions.UnaccessiblePaths, dirPath)
 			result.Permissions.RequiresElevation = true
+			result.addPackageCacheUsage(dirInfo, 0, false)
 			continue
 		}
 
 		// Only scan if we have permission or can try
 		if hasReadPermission(dirPath) {
-			files, size := scanDirectory(dirPath, dirCategory, needsElevation)
+			files, size := s.scanDirectory(dirInfo)
 			result.Files[dirCategory] = append(result.Files[dirCategory], files...)
+			result.CategorySizes[dirCategory] += size
 			result.TotalSize += size
+			result.addPackageCacheUsage(dirInfo, size, true)
 		} else {
 			result.Permissions.UnaccessiblePaths = append(result.Permissions.UnaccessiblePaths, dirPath)
 		}
 	}
+}
 
-	return result
+// CleanMode selects what happens to cleaned files
+type CleanMode string
+
+const (
+	// CleanModeDelete removes files permanently
+	CleanModeDelete CleanMode = "delete"
+	// CleanModeQuarantine moves files into the app's quarantine so they can be restored
+	CleanModeQuarantine CleanMode = "quarantine"
+	// CleanModeTrash moves files into the desktop's Trash (Linux only)
+	CleanModeTrash CleanMode = "trash"
+	// CleanModeCompress gzips files in place; only the space saved counts as cleaned
+	CleanModeCompress CleanMode = "compress"
+)
+
+// CleanOptions configures a clean run
+type CleanOptions struct {
+	Mode CleanMode
+	// AllowOpenFiles removes files even if a running process holds them open
+	AllowOpenFiles bool
+	// Elevate deletes files that need root through the privileged clean helper
+	// (Linux, via pkexec) instead of skipping them. Only CleanModeDelete is supported.
+	Elevate bool
+	// scope is the search whose entries may be cleaned; never set by the frontend
+	scope scanScope
 }
 
 // CleanFiles removes the specified files
 func CleanFiles(files []FileInfo) (int, int64, []string) {
-	cleanedFiles := 0
-	cleanedSize := int64(0)
-	failures := []string{}
-
-	for _, file := range files {
-		// Skip files that need elevation if we don't have it
-		if file.NeedsElevation {
-			permissions := CheckPermissions()
-			if !permissions.IsElevated {
-				failures = append(failures, fmt.Sprintf("Access denied (requires elevation): %s", file.Path))
-				continue
-			}
+	report := CleanFilesWithOptions(files, CleanOptions{Mode: CleanModeDelete})
+	return report.CleanedCount, report.CleanedSize, report.failureMessages()
+}
+
+// CleanFilesWithOptions removes, quarantines, trashes or compresses the specified files
+func CleanFilesWithOptions(files []FileInfo, options CleanOptions) CleanReport {
+	report := newCleanReport()
+
+	plan := planClean(files, options)
+	rules := cleanerRuleIndex(loadCleanerRulesOrDefault())
+
+	mode := options.Mode
+	if mode == "" {
+		mode = CleanModeDelete
+	}
+	audit := newAuditRecorder(string(mode))
+
+	var removing, elevated []FileInfo
+	moving := false
+	for _, item := range plan.Items {
+		if item.Action == ActionRemove {
+			removing = append(removing, item.File)
+			moving = moving || !item.File.Truncate
 		}
+	}
 
-		// Skip if the file is less than 1 minute old (safety measure)
-		info, err := os.Stat(file.Path)
-		if err == nil {
-			if time.Since(info.ModTime()) < 1*time.Minute {
-				failures = append(failures, fmt.Sprintf("Skipped (recently modified): %s", file.Path))
-				continue
-			}
+	// Truncated logs stay in place, so a batch is only made if something moves into it
+	var batch *QuarantineBatch
+	var batchDir string
+	if options.Mode == CleanModeQuarantine && moving {
+		var err error
+		batch, batchDir, err = newQuarantineBatch()
+		if err != nil {
+			report.runFailed(ErrorQuarantineFailed, err)
+			audit.finish(&report)
+			return report
 		}
+		report.QuarantineBatchID = batch.ID
+	}
+	partitions := measurePartitions(removing)
+
+	for _, item := range plan.Items {
+		file := item.File
 
-		// Skip system critical directories/files
-		if isCriticalFile(file.Path) {
-			failures = append(failures, fmt.Sprintf("Skipped (critical file): %s", file.Path))
+		if item.Action == ActionSkip {
+			report.skipped(item)
 			continue
 		}
-
-		// Check write permission
-		if !hasWritePermission(file.Path) {
-			failures = append(failures, fmt.Sprintf("Access denied (no write permission): %s", file.Path))
+		if item.Elevated {
+			elevated = append(elevated, file)
 			continue
 		}
 
-		err = os.RemoveAll(file.Path)
+		// Some caches are read-only on purpose and must be unlocked before removal
+		if rules[file.RuleID].CleanMethod == CleanMethodMakeWritable {
+			makeTreeWritable(file.Path)
+		}
+
+		// Entries already in the Trash are always deleted for good
+		trashEntry := rules[file.RuleID].CleanMethod == CleanMethodTrashEntry
+
+		var err error
+		status := StatusRemoved
+		switch {
+		case file.Truncate:
+			// Live logs stay where they are; only their contents go
+			err = os.Truncate(file.Path, 0)
+			status = StatusTruncated
+		case batch != nil:
+			err = quarantineFile(batch, batchDir, file)
+			status = StatusQuarantined
+		case options.Mode == CleanModeTrash && !trashEntry:
+			err = moveToTrash(file.Path)
+			status = StatusTrashed
+		case options.Mode == CleanModeCompress:
+			var saved int64
+			if saved, err = compressFile(file.Path); err == nil {
+				file.Size = saved
+			}
+			status = StatusCompressed
+		default:
+			err = os.RemoveAll(file.Path)
+		}
+
+		// Only whole Trash entries have a .trashinfo, not what's inside them
+		if err == nil && trashEntry {
+			if root, _ := scannedRoot(file.Path); filepath.Dir(file.Path) == root {
+				os.Remove(trashInfoPath(file.Path))
+			}
+		}
+
 		if err == nil {
-			cleanedFiles++
-			cleanedSize += file.Size
+			report.cleaned(file, status)
 		} else {
-			failures = append(failures, fmt.Sprintf("Failed to remove: %s (Error: %s)", file.Path, err))
+			report.failed(file, err)
+		}
+	}
+
+	// Files needing root go to the helper in one batch, so pkexec only asks once
+	if len(elevated) > 0 {
+		results, err := runCleanHelper(elevated)
+		if err != nil {
+			report.runFailed(ErrorElevationFailed, err)
+		}
+		for _, result := range results {
+			report.add(result)
 		}
 	}
 
-	return cleanedFiles, cleanedSize, failures
+	// Warn about removed files whose space is still held by running processes
+	held := heldOpenAfterClean(&report)
+	report.HeldOpen, report.HeldOpenSize = held.Processes, held.TotalSize
+
+	report.Partitions = partitions.finish()
+	audit.finish(&report)
+	return report
 }
 
 // GetFormattedSize converts bytes to human-readable format
@@ -162,142 +331,25 @@ func GetElevationCommand(execPath string) string {
 // Helper functions
 
 type DirInfo struct {
-	Path     string
-	Location string
-}
-
-func getSystemTempDirs() []DirInfo {
-	var dirs []DirInfo
-
-	switch runtime.GOOS {
-	case "windows":
-		dirs = []DirInfo{
-			{os.TempDir(), "System Temp"},
-			{"C:\\Windows\\Temp", "Windows Temp"},
-			{filepath.Join(os.Getenv("LOCALAPPDATA"), "Temp"), "User Temp"},
-		}
-	case "linux":
-		dirs = []DirInfo{
-			{"/tmp", "System Temp"},
-			{"/var/tmp", "System Temp"},
-			{filepath.Join(os.Getenv("HOME"), ".cache"), "User Cache"},
-		}
-	case "darwin":
-		dirs = []DirInfo{
-			{"/tmp", "System Temp"},
-			{"/private/tmp", "System Temp"},
-			{filepath.Join(os.Getenv("HOME"), "Library/Caches"), "User Cache"},
-		}
-	}
-
-	return dirs
-}
-
-func getBrowserCacheDirs() []DirInfo {
-	var dirs []DirInfo
-	home := os.Getenv("HOME")
-	if runtime.GOOS == "windows" {
-		home = os.Getenv("USERPROFILE")
-	}
-
-	switch runtime.GOOS {
-	case "windows":
-		appData := os.Getenv("LOCALAPPDATA")
-		dirs = []DirInfo{
-			{filepath.Join(appData, "Google", "Chrome", "User Data", "Default", "Cache"), "Chrome Cache"},
-			{filepath.Join(appData, "Mozilla", "Firefox", "Profiles"), "Firefox Cache"},
-			{filepath.Join(appData, "Microsoft", "Edge", "User Data", "Default", "Cache"), "Edge Cache"},
-		}
-	case "linux":
-		dirs = []DirInfo{
-			{filepath.Join(home, ".cache", "google-chrome"), "Chrome Cache"},
-			{filepath.Join(home, ".mozilla", "firefox"), "Firefox Cache"},
-			{filepath.Join(home, ".config", "microsoft-edge", "Default", "Cache"), "Edge Cache"},
-		}
-	case "darwin":
-		dirs = []DirInfo{
-			{filepath.Join(home, "Library", "Caches", "Google", "Chrome"), "Chrome Cache"},
-			{filepath.Join(home, "Library", "Caches", "Firefox"), "Firefox Cache"},
-			{filepath.Join(home, "Library", "Caches", "Microsoft Edge"), "Edge Cache"},
-		}
-	}
-
-	return dirs
-}
-
-func scanDirectory(dirPath, category string, needsElevation bool) ([]FileInfo, int64) {
-	var files []FileInfo
-	var totalSize int64
-
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		return files, 0
-	}
-
-	for _, entry := range entries {
-		fullPath := filepath.Join(dirPath, entry.Name())
-
-		// Skip system critical files
-		if isCriticalFile(fullPath) {
-			continue
-		}
-
-		info, err := os.Stat(fullPath)
-		if err != nil {
-			continue
-		}
-
-		// Skip files being used by the system
-		if time.Since(info.ModTime()) < 1*time.Minute {
-			continue
-		}
-
-		size := int64(0)
-		if info.IsDir() {
-			// Calculate directory size
-			filepath.Walk(fullPath, func(_ string, info os.FileInfo, err error) error {
-				if err == nil && !info.IsDir() {
-					size += info.Size()
-				}
-				return nil
-			})
-		} else {
-			size = info.Size()
-		}
-
-		files = append(files, FileInfo{
-			Path:           fullPath,
-			Size:           size,
-			Name:           entry.Name(),
-			Location:       category,
-			NeedsElevation: needsElevation,
-		})
-		totalSize += size
-	}
+	Path           string
+	Location       string
+	Profile        string
+	RuleID         string
+	MinAge         time.Duration
+	NeedsElevation bool
 
-	return files, totalSize
+	rule CleanerRule
+	// nested are the directories of other rules inside Path; those rules clean them
+	nested []string
 }
 
-func isCriticalFile(path string) bool {
-	// List of critical directories/files to avoid
-	criticalPatterns := []string{
-		"System Volume Information",
-		"$Recycle.Bin",
-		"pagefile.sys",
-		"hiberfil.sys",
-		"swapfile.sys",
-		"/proc",
-		"/sys",
-		"/dev",
-		"/boot",
-	}
-
-	for _, pattern := range criticalPatterns {
-		if strings.Contains(path, pattern) {
+// holdsNested reports whether path is, or contains, the directory of another rule
+func (d DirInfo) holdsNested(path string) bool {
+	for _, nested := range d.nested {
+		if isWithin(path, nested) {
 			return true
 		}
 	}
-
 	return false
 }
 
@@ -307,12 +359,17 @@ func hasReadPermission(path string) bool {
 }
 
 func hasWritePermission(path string) bool {
-	// Check if file exists first
-	info, err := os.Stat(path)
+	// Check if file exists first, without following symlinks
+	info, err := os.Lstat(path)
 	if err != nil {
 		return false
 	}
 
+	// Removing a symlink only needs write access to the directory holding it
+	if info.Mode()&os.ModeSymlink != 0 {
+		return hasWritePermission(filepath.Dir(path))
+	}
+
 	// For directories, try to create a test file
 	if info.IsDir() {
 		testFile := filepath.Join(path, ".permission_test")
@@ -334,6 +391,9 @@ func hasWritePermission(path string) bool {
 	return true
 }
 
+// checkPermissions is CheckPermissions, replaceable in tests
+var checkPermissions = CheckPermissions
+
 func CheckPermissions() PermissionStatus {
 	status := PermissionStatus{
 		IsElevated:        false,
@@ -353,6 +413,7 @@ func CheckPermissions() PermissionStatus {
 		status.IsElevated = os.Geteuid() == 0
 		if runtime.GOOS == "linux" {
 			status.ElevationCommand = "Run with 'sudo' or use pkexec"
+			status.HelperAvailable = cleanHelperAvailable()
 		} else {
 			status.ElevationCommand = "Run with 'sudo'"
 		}
@@ -404,94 +465,50 @@ func needsElevatedPermissions(path string) bool {
 func GetUserFriendlyDirectories() []DirInfo {
 	var result []DirInfo
 
-	// Always include user-specific directories
-	home := os.Getenv("HOME")
-	if runtime.GOOS == "windows" {
-		// home = os.Getenv("USERPROFILE")
-		appData := os.Getenv("LOCALAPPDATA")
-
-		result = append(result, DirInfo{
-			Path:     filepath.Join(appData, "Temp"),
-			Location: "User Temp",
-		})
-
-		// Browser caches
-		result = append(result, DirInfo{
-			Path:     filepath.Join(appData, "Google", "Chrome", "User Data", "Default", "Cache"),
-			Location: "Chrome Cache",
-		})
-		result = append(result, DirInfo{
-			Path:     filepath.Join(appData, "Mozilla", "Firefox", "Profiles"),
-			Location: "Firefox Cache",
-		})
-		result = append(result, DirInfo{
-			Path:     filepath.Join(appData, "Microsoft", "Edge", "User Data", "Default", "Cache"),
-			Location: "Edge Cache",
-		})
-
-	} else if runtime.GOOS == "linux" {
-		result = append(result, DirInfo{
-			Path:     filepath.Join(home, ".cache"),
-			Location: "User Cache",
-		})
-
-		// Browser caches
-		result = append(result, DirInfo{
-			Path:     filepath.Join(home, ".cache", "google-chrome"),
-			Location: "Chrome Cache",
-		})
-		result = append(result, DirInfo{
-			Path:     filepath.Join(home, ".mozilla", "firefox"),
-			Location: "Firefox Cache",
-		})
-
-	} else if runtime.GOOS == "darwin" {
-		result = append(result, DirInfo{
-			Path:     filepath.Join(home, "Library", "Caches"),
-			Location: "User Cache",
-		})
-
-		// Browser caches
-		result = append(result, DirInfo{
-			Path:     filepath.Join(home, "Library", "Caches", "Google", "Chrome"),
-			Location: "Chrome Cache",
-		})
-		result = append(result, DirInfo{
-			Path:     filepath.Join(home, "Library", "Caches", "Firefox"),
-			Location: "Firefox Cache",
-		})
-		result = append(result, DirInfo{
-			Path:     filepath.Join(home, "Library", "Caches", "Microsoft Edge"),
-			Location: "Edge Cache",
-		})
-	}
-
-	// Filter to only include directories that actually exist and we have permission for
-	var filteredResult []DirInfo
-	for _, dir := range result {
-		if _, err := os.Stat(dir.Path); err == nil {
-			if hasReadPermission(dir.Path) {
-				filteredResult = append(filteredResult, dir)
-			}
+	for _, dir := range cleanerDirs(loadCleanerRulesOrDefault()) {
+		// Only include directories we have permission for
+		if !dir.NeedsElevation && hasReadPermission(dir.Path) {
+			result = append(result, dir)
 		}
 	}
 
-	return filteredResult
+	return result
 }
 
 // SafeClean only cleans directories that don't require elevated permissions
 func SafeClean() CleanerResult {
+	result, _ := SafeCleanContext(context.Background(), nil)
+	return result
+}
+
+// SafeCleanContext is SafeClean with cancellation and progress reporting
+func SafeCleanContext(ctx context.Context, progress ScanProgressFunc) (CleanerResult, error) {
+	return SafeCleanWithOptions(ctx, ScanOptions{}, progress)
+}
+
+// SafeCleanWithOptions is SafeCleanContext with control over the scan cache
+func SafeCleanWithOptions(ctx context.Context, options ScanOptions, progress ScanProgressFunc) (CleanerResult, error) {
+	resetScannedFiles(scopeCleaner)
+	scanner := newCleanerScanner(ctx, progress)
+	scanner.openFiles = buildOpenFileIndex()
+	scanner.cache = openScanCache(options.ForceRescan)
+	defer scanner.cache.save()
+
 	result := CleanerResult{
-		Files:       make(map[string][]FileInfo),
-		TotalSize:   0,
-		Permissions: CheckPermissions(),
+		Files:         make(map[string][]FileInfo),
+		CategorySizes: make(map[string]int64),
+		TotalSize:     0,
+		Permissions:   CheckPermissions(),
 	}
 
 	// Only get directories that are safe to clean
 	userDirs := GetUserFriendlyDirectories()
 
 	for _, dirInfo := range userDirs {
-		dirPath := dirInfo.Path
+		if ctx.Err() != nil {
+			break
+		}
+
 		dirCategory := dirInfo.Location
 
 		if _, exists := result.Files[dirCategory]; !exists {
@@ -499,10 +516,14 @@ func SafeClean() CleanerResult {
 		}
 
 		// We already filtered for permission, so just scan
-		files, size := scanDirectory(dirPath, dirCategory, false) // Never needs elevation
+		files, size := scanner.scanDirectory(dirInfo)
 		result.Files[dirCategory] = append(result.Files[dirCategory], files...)
+		result.CategorySizes[dirCategory] += size
 		result.TotalSize += size
 	}
 
-	return result
+	result.Skipped = scanner.skippedFiles()
+	result.Thumbnails = scanner.thumbnailUsage()
+	scanner.report("", true)
+	return result, ctx.Err()
 }
@@ -0,0 +1,525 @@
+package functions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// partialHashBlock is how much of the start and end of a file the partial hash reads
+	partialHashBlock        = 4096
+	defaultDuplicateMinSize = 1
+	duplicatesCategory      = "Duplicates"
+)
+
+// DuplicateOptions configures FindDuplicates
+type DuplicateOptions struct {
+	MinSize int64 `json:"minSize"`
+}
+
+// DuplicateFile is one copy in a duplicate group
+type DuplicateFile struct {
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// DuplicateGroup is a set of files with identical contents
+type DuplicateGroup struct {
+	Hash            string          `json:"hash"`
+	Size            int64           `json:"size"`
+	Files           []DuplicateFile `json:"files"`
+	ReclaimableSize int64           `json:"reclaimableSize"`
+}
+
+// DuplicateReport is the result of FindDuplicates
+type DuplicateReport struct {
+	Groups           []DuplicateGroup `json:"groups"`
+	TotalReclaimable int64            `json:"totalReclaimable"`
+	FilesScanned     int64            `json:"filesScanned"`
+}
+
+// lastDuplicates remembers which group each path of the last report belongs to,
+// so actions can make sure at least one copy of every group survives
+var lastDuplicates struct {
+	sync.Mutex
+	groups map[string]*rememberedGroup
+}
+
+// rememberedGroup is a group of the last report, minus the copies removed since
+type rememberedGroup struct {
+	hash  string
+	size  int64
+	paths []string
+}
+
+type sizedFile struct {
+	root string
+	path string
+	info fs.FileInfo
+}
+
+// FindDuplicates looks for files with identical contents below roots. Candidates
+// are narrowed down by size, then by a hash of their first and last blocks, and
+// only then confirmed with a full hash.
+func FindDuplicates(ctx context.Context, roots []string, options DuplicateOptions, progress ScanProgressFunc) (*DuplicateReport, error) {
+	if options.MinSize <= 0 {
+		options.MinSize = defaultDuplicateMinSize
+	}
+
+	scanner := newCleanerScanner(ctx, progress)
+
+	// Stage 1: group by size
+	bySize := map[int64][]sizedFile{}
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		if isProtectedPath(root) {
+			return nil, fmt.Errorf("refusing to scan protected path: %s", root)
+		}
+
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil || isProtectedPath(path) {
+				if d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				scanner.report(path, false)
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil || info.Size() < options.MinSize {
+				return nil
+			}
+
+			scanner.filesCounted.Add(1)
+			scanner.bytesFound.Add(info.Size())
+			bySize[info.Size()] = append(bySize[info.Size()], sizedFile{root: root, path: path, info: info})
+			return nil
+		})
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Only confirmed copies may be removed, and only through the duplicate actions
+	resetScannedFiles(scopeDuplicates)
+
+	report := &DuplicateReport{
+		Groups:       []DuplicateGroup{},
+		FilesScanned: scanner.filesCounted.Load(),
+	}
+
+	for size, files := range bySize {
+		files = withoutHardlinks(files)
+		if len(files) < 2 {
+			continue
+		}
+
+		// Stage 2: partial hash, stage 3: full hash
+		for _, partial := range groupByHash(ctx, files, partialHash) {
+			for hash, full := range groupByHash(ctx, partial, fullHash) {
+				group := DuplicateGroup{Hash: hash, Size: size}
+				for _, file := range full {
+					registerScopedFile(scopeDuplicates, file.root, "", file.path, file.info)
+					group.Files = append(group.Files, DuplicateFile{Path: file.path, ModTime: file.info.ModTime()})
+				}
+				sort.Slice(group.Files, func(i, j int) bool { return group.Files[i].Path < group.Files[j].Path })
+				group.ReclaimableSize = size * int64(len(group.Files)-1)
+
+				report.Groups = append(report.Groups, group)
+				report.TotalReclaimable += group.ReclaimableSize
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(report.Groups, func(i, j int) bool {
+		return report.Groups[i].ReclaimableSize > report.Groups[j].ReclaimableSize
+	})
+
+	scanner.report("", true)
+	rememberDuplicates(report)
+	return report, nil
+}
+
+// withoutHardlinks drops files that are already hardlinks of another file in the list
+func withoutHardlinks(files []sizedFile) []sizedFile {
+	var unique []sizedFile
+	for _, file := range files {
+		linked := false
+		for _, other := range unique {
+			if os.SameFile(file.info, other.info) {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			unique = append(unique, file)
+		}
+	}
+	return unique
+}
+
+// groupByHash hashes files concurrently and returns the groups with more than one file
+func groupByHash(ctx context.Context, files []sizedFile, hash func(string, int64) (string, error)) map[string][]sizedFile {
+	type hashed struct {
+		file sizedFile
+		sum  string
+	}
+
+	results := make(chan hashed)
+	jobs := make(chan sizedFile)
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				if sum, err := hash(file.path, file.info.Size()); err == nil {
+					results <- hashed{file: file, sum: sum}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for _, file := range files {
+			jobs <- file
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	groups := map[string][]sizedFile{}
+	for result := range results {
+		groups[result.sum] = append(groups[result.sum], result.file)
+	}
+
+	for sum, group := range groups {
+		if len(group) < 2 {
+			delete(groups, sum)
+		}
+	}
+	return groups
+}
+
+// partialHash hashes the first and last block of a file
+func partialHash(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, partialHashBlock); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	if size > partialHashBlock {
+		if _, err := f.Seek(-min(partialHashBlock, size-partialHashBlock), io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fullHash(path string, _ int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func rememberDuplicates(report *DuplicateReport) {
+	lastDuplicates.Lock()
+	defer lastDuplicates.Unlock()
+
+	lastDuplicates.groups = map[string]*rememberedGroup{}
+	for _, group := range report.Groups {
+		remembered := &rememberedGroup{hash: group.Hash, size: group.Size}
+		for _, file := range group.Files {
+			remembered.paths = append(remembered.paths, file.Path)
+			lastDuplicates.groups[file.Path] = remembered
+		}
+	}
+}
+
+// forgetDuplicates drops the copies a run removed, so later runs don't count on them
+func forgetDuplicates(report CleanReport) {
+	lastDuplicates.Lock()
+	defer lastDuplicates.Unlock()
+
+	for _, item := range report.Items {
+		switch item.Status {
+		case StatusRemoved, StatusQuarantined, StatusTrashed:
+		default:
+			continue
+		}
+
+		group, exists := lastDuplicates.groups[item.Path]
+		if !exists {
+			continue
+		}
+		delete(lastDuplicates.groups, item.Path)
+		forgetScannedFile(scopeDuplicates, item.Path)
+
+		for i, path := range group.paths {
+			if path == item.Path {
+				group.paths = append(group.paths[:i], group.paths[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// duplicateSelection checks that every path belongs to the last report and that
+// at least one copy of each affected group is left untouched. A copy only counts
+// as left if it is still there with the group's contents.
+func duplicateSelection(paths []string, keep map[string]bool) ([]FileInfo, []CleanPlanItem) {
+	var skipped []CleanPlanItem
+
+	lastDuplicates.Lock()
+	selected := map[string]*rememberedGroup{}
+	var order []string
+	for _, path := range paths {
+		group, exists := lastDuplicates.groups[path]
+		if !exists {
+			skipped = append(skipped, duplicateSkip(path, 0, SkipNotDuplicate))
+			continue
+		}
+		if keep[path] || selected[path] != nil {
+			continue
+		}
+		selected[path] = group
+		order = append(order, path)
+	}
+
+	// The copies of each group nobody asked to remove; if that's none, the last
+	// selected one stays
+	kept := map[*rememberedGroup][]string{}
+	for _, path := range order {
+		group := selected[path]
+		if _, done := kept[group]; done {
+			continue
+		}
+		kept[group] = []string{}
+		for _, other := range group.paths {
+			if selected[other] == nil {
+				kept[group] = append(kept[group], other)
+			}
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		path := order[i]
+		if group := selected[path]; len(kept[group]) == 0 {
+			kept[group] = []string{path}
+			delete(selected, path)
+			skipped = append(skipped, duplicateSkip(path, group.size, SkipLastCopy))
+		}
+	}
+	lastDuplicates.Unlock()
+
+	// Hashing happens outside the lock, it may take a while
+	intact := map[*rememberedGroup]bool{}
+	for group, copies := range kept {
+		intact[group] = hasIntactCopy(copies, group)
+	}
+
+	var files []FileInfo
+	for _, path := range order {
+		group := selected[path]
+		if group == nil {
+			continue
+		}
+		if !intact[group] {
+			skipped = append(skipped, duplicateSkip(path, group.size, SkipLastCopy))
+			continue
+		}
+
+		files = append(files, FileInfo{
+			Path:     path,
+			Size:     group.size,
+			Name:     filepath.Base(path),
+			Location: duplicatesCategory,
+		})
+	}
+
+	return files, skipped
+}
+
+// hasIntactCopy reports whether one of copies is still a regular file with the
+// group's size and contents
+func hasIntactCopy(copies []string, group *rememberedGroup) bool {
+	for _, path := range copies {
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Size() != group.size {
+			continue
+		}
+		if hash, err := fullHash(path, group.size); err == nil && hash == group.hash {
+			return true
+		}
+	}
+	return false
+}
+
+func duplicateSkip(path string, size int64, reason SkipReason) CleanPlanItem {
+	return CleanPlanItem{
+		File:   FileInfo{Path: path, Size: size, Name: filepath.Base(path), Location: duplicatesCategory},
+		Action: ActionSkip,
+		Reason: reason,
+	}
+}
+
+// DeleteDuplicates removes the chosen copies through the same checks as CleanFiles.
+// It refuses to remove every copy of a group.
+func DeleteDuplicates(paths []string, options CleanOptions) CleanReport {
+	files, skipped := duplicateSelection(paths, nil)
+
+	options.scope = scopeDuplicates
+	report := CleanFilesWithOptions(files, options)
+	for _, item := range skipped {
+		report.skipped(item)
+	}
+	forgetDuplicates(report)
+	return report
+}
+
+// HardlinkDuplicates replaces each duplicate with a hardlink to keep. The files must
+// be in the same group of the last report and on the same filesystem.
+func HardlinkDuplicates(keep string, duplicates []string) CleanReport {
+	files, skipped := duplicateSelection(duplicates, map[string]bool{keep: true})
+	report := newCleanReport()
+	for _, item := range skipped {
+		report.skipped(item)
+	}
+
+	lastDuplicates.Lock()
+	keepGroup := lastDuplicates.groups[keep]
+	lastDuplicates.Unlock()
+	if keepGroup == nil {
+		report.skipped(duplicateSkip(keep, 0, SkipNotDuplicate))
+		return report
+	}
+
+	// keep must be the file the search found, and stay so until every link is made
+	if _, reason, skip := verifyScannedPath(scopeDuplicates, keep); skip {
+		report.skipped(duplicateSkip(keep, keepGroup.size, reason))
+		return report
+	}
+	keepInfo, err := os.Lstat(keep)
+	if err != nil {
+		report.skipped(duplicateSkip(keep, keepGroup.size, SkipFileChanged))
+		return report
+	}
+	keepUnchanged := func() bool {
+		if _, _, skip := verifyScannedPath(scopeDuplicates, keep); skip {
+			return false
+		}
+		info, err := os.Lstat(keep)
+		return err == nil && info.Size() == keepInfo.Size() && info.ModTime().Equal(keepInfo.ModTime())
+	}
+
+	keepHash, err := fullHash(keep, 0)
+	if err != nil || keepHash != keepGroup.hash {
+		report.skipped(duplicateSkip(keep, keepGroup.size, SkipFileChanged))
+		return report
+	}
+
+	audit := newAuditRecorder("hardlink")
+	partitions := measurePartitions(files)
+
+	plan := planClean(files, CleanOptions{scope: scopeDuplicates})
+	for _, item := range plan.Items {
+		file := item.File
+
+		if item.Action == ActionSkip {
+			report.skipped(item)
+			continue
+		}
+
+		lastDuplicates.Lock()
+		sameGroup := lastDuplicates.groups[file.Path] == keepGroup
+		lastDuplicates.Unlock()
+		if !sameGroup {
+			report.skipped(duplicateSkip(file.Path, file.Size, SkipDifferentGroup))
+			continue
+		}
+
+		// Contents must still match right before the link replaces the file
+		if hash, err := fullHash(file.Path, 0); err != nil || hash != keepHash || !keepUnchanged() {
+			report.skipped(duplicateSkip(file.Path, file.Size, SkipFileChanged))
+			continue
+		}
+
+		if err := replaceWithHardlink(keep, file.Path); err != nil {
+			report.failed(file, err)
+			continue
+		}
+
+		report.cleaned(file, StatusLinked)
+	}
+
+	report.Partitions = partitions.finish()
+	audit.finish(&report)
+	return report
+}
+
+// replaceWithHardlink atomically swaps target for a hardlink to source
+func replaceWithHardlink(source, target string) error {
+	tmp := filepath.Join(filepath.Dir(target), fmt.Sprintf(".%s.link-%d", filepath.Base(target), time.Now().UnixNano()))
+
+	if err := os.Link(source, tmp); err != nil {
+		if isCrossDeviceError(err) {
+			return errors.New("files are on different filesystems")
+		}
+		return err
+	}
+
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
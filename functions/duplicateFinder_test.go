@@ -0,0 +1,124 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindAndHardlinkDuplicates(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	path := func(name string) string { return filepath.Join(root, name) }
+	for name, data := range map[string]string{
+		"a1": "first", "a2": "first", "a3": "first",
+		"b1": "second", "b2": "second",
+		"unique": "only one",
+	} {
+		writeTestFile(t, path(name), []byte(data))
+		backdate(t, path(name))
+	}
+
+	report, err := FindDuplicates(context.Background(), []string{root}, DuplicateOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Groups) != 2 || report.TotalReclaimable != int64(2*len("first")+len("second")) {
+		t.Fatalf("Expected 2 groups, got: %+v", report)
+	}
+
+	// Every copy is selected, but one has to stay
+	if run := DeleteDuplicates([]string{path("a1"), path("a2"), path("a3")}, CleanOptions{Mode: CleanModeDelete}); run.CleanedCount != 2 {
+		t.Errorf("Expected two of the three copies to be removed, got: %+v", run)
+	}
+	left := 0
+	for _, name := range []string{"a1", "a2", "a3"} {
+		if _, err := os.Stat(path(name)); err == nil {
+			left++
+		}
+	}
+	if left != 1 {
+		t.Errorf("Expected one copy to be left, got %d", left)
+	}
+
+	if run := HardlinkDuplicates(path("b1"), []string{path("b2")}); run.CleanedCount != 1 {
+		t.Fatalf("Expected b2 to be linked, got: %+v", run)
+	}
+	b1, _ := os.Stat(path("b1"))
+	b2, err := os.Stat(path("b2"))
+	if err != nil || !os.SameFile(b1, b2) {
+		t.Errorf("Expected b2 to be a hardlink to b1 (%v)", err)
+	}
+}
+
+func TestDeleteDuplicatesKeepsAnIntactCopy(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	path := func(name string) string { return filepath.Join(root, name) }
+	for name, data := range map[string]string{
+		"a1": "first", "a2": "first", "a3": "first",
+		"b1": "second", "b2": "second",
+		"unique": "only one",
+	} {
+		writeTestFile(t, path(name), []byte(data))
+		backdate(t, path(name))
+	}
+
+	report, err := FindDuplicates(context.Background(), []string{root}, DuplicateOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Groups) != 2 {
+		t.Fatalf("Expected 2 groups, got: %+v", report.Groups)
+	}
+
+	// Only confirmed copies are registered, and not for the cleaner
+	if _, _, skip := verifyScannedPath(scopeDuplicates, path("unique")); !skip {
+		t.Errorf("Expected a file without copies not to be registered")
+	}
+	if _, _, skip := verifyScannedPath(scopeCleaner, path("a1")); !skip {
+		t.Errorf("Expected duplicates not to be deletable through the cleaner")
+	}
+	if _, _, skip := verifyScannedPath(scopeDuplicates, path("a1")); skip {
+		t.Errorf("Expected a1 to be registered as a duplicate")
+	}
+
+	status := func(report CleanReport, name string) (CleanItemStatus, SkipReason) {
+		for _, item := range report.Items {
+			if item.Path == path(name) {
+				return item.Status, item.Reason
+			}
+		}
+		return "", ""
+	}
+
+	// Removing copies one run at a time still leaves the last one
+	run := DeleteDuplicates([]string{path("a1")}, CleanOptions{Mode: CleanModeDelete})
+	if got, _ := status(run, "a1"); got != StatusRemoved {
+		t.Fatalf("Expected a1 to be removed, got %s", got)
+	}
+	run = DeleteDuplicates([]string{path("a2")}, CleanOptions{Mode: CleanModeDelete})
+	if got, _ := status(run, "a2"); got != StatusRemoved {
+		t.Fatalf("Expected a2 to be removed, got %s", got)
+	}
+	run = DeleteDuplicates([]string{path("a3")}, CleanOptions{Mode: CleanModeDelete})
+	if got, reason := status(run, "a3"); got != StatusSkipped || reason != SkipLastCopy {
+		t.Errorf("Expected a3 to be kept as the last copy, got %s (%s)", got, reason)
+	}
+
+	// A kept copy that changed since the search doesn't count
+	os.WriteFile(path("b2"), []byte("edited"), 0644)
+	run = DeleteDuplicates([]string{path("b1")}, CleanOptions{Mode: CleanModeDelete})
+	if got, reason := status(run, "b1"); got != StatusSkipped || reason != SkipLastCopy {
+		t.Errorf("Expected b1 to be kept when b2 changed, got %s (%s)", got, reason)
+	}
+
+	for _, name := range []string{"a3", "b1", "b2"} {
+		if _, err := os.Stat(path(name)); err != nil {
+			t.Errorf("Expected %s to survive: %v", name, err)
+		}
+	}
+}
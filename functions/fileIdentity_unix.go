@@ -0,0 +1,63 @@
+//go:build !windows
+
+package functions
+
+import (
+	"os"
+	"syscall"
+)
+
+// identityOf returns the device and inode of an Lstat result
+func identityOf(_ string, info os.FileInfo) (fileIdentity, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileIdentity{}, false
+	}
+	return fileIdentity{Device: uint64(st.Dev), Inode: uint64(st.Ino)}, true
+}
+
+// isHardlinked reports whether an Lstat result has more than one name
+func isHardlinked(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Nlink > 1
+}
+
+// deviceOf returns the device an Lstat result lives on
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// chownLike gives f the owner and group of info, if it didn't get them already
+func chownLike(f *os.File, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	current, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if cst, ok := current.Sys().(*syscall.Stat_t); ok && cst.Uid == st.Uid && cst.Gid == st.Gid {
+		return nil
+	}
+	return f.Chown(int(st.Uid), int(st.Gid))
+}
+
+// ownedByRoot reports whether an Lstat result belongs to uid 0
+func ownedByRoot(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Uid == 0
+}
+
+// ownedByCurrentUser reports whether info belongs to the uid the app runs as
+func ownedByCurrentUser(info os.FileInfo) bool {
+	if info == nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
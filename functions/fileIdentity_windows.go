@@ -0,0 +1,59 @@
+package functions
+
+import (
+	"os"
+	"syscall"
+)
+
+// identityOf returns the volume serial number and file index of path. Windows does
+// not put these in os.FileInfo, so the file is opened without following reparse points.
+func identityOf(path string, _ os.FileInfo) (fileIdentity, bool) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return fileIdentity{}, false
+	}
+
+	handle, err := syscall.CreateFile(name, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return fileIdentity{}, false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var data syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(handle, &data); err != nil {
+		return fileIdentity{}, false
+	}
+
+	return fileIdentity{
+		Device: uint64(data.VolumeSerialNumber),
+		Inode:  uint64(data.FileIndexHigh)<<32 | uint64(data.FileIndexLow),
+	}, true
+}
+
+// isHardlinked is not available from os.FileInfo on Windows, where hardlinks are
+// rare enough that asking for every file's link count isn't worth it
+func isHardlinked(_ os.FileInfo) bool {
+	return false
+}
+
+// deviceOf is not available from os.FileInfo on Windows. Mount points there are
+// reparse points, which the scanners never descend into anyway.
+func deviceOf(_ os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// chownLike does nothing on Windows, where new files inherit their ACL from the directory
+func chownLike(_ *os.File, _ os.FileInfo) error {
+	return nil
+}
+
+// ownedByRoot is never true on Windows, which has no clean helper
+func ownedByRoot(_ os.FileInfo) bool {
+	return false
+}
+
+// ownedByCurrentUser is never true on Windows, where open files aren't indexed anyway
+func ownedByCurrentUser(_ os.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package functions
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLockFile takes an exclusive lock on f without waiting, returning errLockHeld
+// when another open file holds it. The lock goes away with the descriptor, so a
+// crashed process never leaves it behind.
+func tryLockFile(f *os.File) error {
+	err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return errLockHeld
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// renameFile is os.Rename, replaceable in tests to act like another device
+var renameFile = os.Rename
+
+// moveFile moves a file or directory tree. It renames when possible and falls back
+// to copy+delete when source and destination are on different devices.
+func moveFile(src, dst string) error {
+	err := renameFile(src, dst)
+	if err == nil || !isCrossDeviceError(err) {
+		return err
+	}
+
+	if err := copyPath(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return fmt.Errorf("error copying %s: %w", src, err)
+	}
+
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("copied but could not remove %s: %w", src, err)
+	}
+	return nil
+}
+
+func isCrossDeviceError(err error) bool {
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) {
+		return false
+	}
+
+	errno, ok := linkErr.Err.(syscall.Errno)
+	if !ok {
+		return false
+	}
+
+	// ERROR_NOT_SAME_DEVICE is what MoveFileEx returns on Windows
+	if runtime.GOOS == "windows" {
+		return errno == syscall.Errno(17)
+	}
+	return errno == syscall.EXDEV
+}
+
+// copyPath copies a file, symlink or directory tree, preserving modes and modification times
+func copyPath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+
+	case info.IsDir():
+		// Create writable first so children can be copied in, then apply the real mode
+		if err := os.Mkdir(dst, 0700); err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyPath(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+
+		if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	case info.Mode().IsRegular():
+		if err := copyRegularFile(src, dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	default:
+		return fmt.Errorf("unsupported file type: %s", src)
+	}
+}
+
+func copyRegularFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// The umask may have stripped bits from perm on create
+	return os.Chmod(dst, perm)
+}
+
+// writeFileAtomic writes to a temp file first so a crash never leaves a truncated file
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// syncDir flushes a directory's entries to disk after a rename. Not every OS can
+// sync a directory, so errors are ignored.
+func syncDir(dir string) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Sync()
+}
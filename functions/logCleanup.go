@@ -0,0 +1,258 @@
+package functions
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	systemLogDir  = "/var/log"
+	journalLogDir = "/var/log/journal"
+)
+
+var (
+	compressedLogExt = regexp.MustCompile(`\.(gz|xz|bz2|zst|lz4|Z)$`)
+	// logrotate's numbered (.1), dateext (-20240131) and .old rotations
+	rotationSuffix = regexp.MustCompile(`(\.\d+|-\d{8}(\d{2}){0,3}|\.old)$`)
+
+	// Active logs with these names (or ending in .log) are text and safe to truncate;
+	// binary ones like wtmp and lastlog are never touched
+	textLogNames = map[string]bool{
+		"syslog": true, "messages": true, "secure": true, "maillog": true,
+		"cron": true, "debug": true, "daemon": true, "user": true,
+	}
+)
+
+// logFile is a regular file found below a log directory
+type logFile struct {
+	path string
+	info fs.FileInfo
+}
+
+func systemLogDirs() []string { return []string{systemLogDir} }
+
+func journalDirs() []string { return []string{journalLogDir} }
+
+// rotatedLogBase returns the name of the live log a rotated or compressed log came
+// from, and whether name is one
+func rotatedLogBase(name string) (string, bool) {
+	base := compressedLogExt.ReplaceAllString(name, "")
+	rotated := base != name
+
+	if stripped := rotationSuffix.ReplaceAllString(base, ""); stripped != base && stripped != "" {
+		base, rotated = stripped, true
+	}
+	return base, rotated
+}
+
+func isTextLog(name string) bool {
+	return strings.HasSuffix(name, ".log") || textLogNames[name]
+}
+
+// scanRotatedLogs offers the rotations of each log beyond the newest KeepRotations,
+// and truncation of live text logs larger than TruncateOver. Live logs are never
+// offered for deletion.
+func (s *cleanerScanner) scanRotatedLogs(dir DirInfo) ([]FileInfo, int64) {
+	truncateOver, _ := parseByteSize(dir.rule.TruncateOver)
+
+	rotations := map[string][]logFile{}
+	var files []FileInfo
+	var totalSize int64
+
+	s.walkLogDir(dir, func(file logFile) {
+		name := filepath.Base(file.path)
+		base, rotated := rotatedLogBase(name)
+
+		if rotated {
+			key := filepath.Join(filepath.Dir(file.path), base)
+			rotations[key] = append(rotations[key], file)
+			return
+		}
+
+		if truncateOver > 0 && isTextLog(name) && file.info.Size() > truncateOver {
+			entry := s.logEntry(dir, file)
+			entry.Name = fmt.Sprintf("%s (truncate)", entry.Name)
+			entry.Truncate = true
+			markTruncateOnly(file.path)
+			files = append(files, entry)
+			totalSize += entry.Size
+		}
+	})
+
+	rotated, size := s.oldRotations(dir, rotations)
+	return append(files, rotated...), totalSize + size
+}
+
+// scanJournal offers the archived journal files of each journal beyond the newest
+// KeepRotations. The active system.journal and user-*.journal files are left alone.
+func (s *cleanerScanner) scanJournal(dir DirInfo) ([]FileInfo, int64) {
+	rotations := map[string][]logFile{}
+
+	s.walkLogDir(dir, func(file logFile) {
+		journal, archived := archivedJournal(filepath.Base(file.path))
+		if !archived {
+			return
+		}
+
+		key := filepath.Join(filepath.Dir(file.path), journal)
+		rotations[key] = append(rotations[key], file)
+	})
+
+	return s.oldRotations(dir, rotations)
+}
+
+// archivedJournal returns the journal an archived journal file belongs to. Archived
+// files are named system@<id>.journal, or end in ~ after an unclean shutdown.
+func archivedJournal(name string) (string, bool) {
+	trimmed := strings.TrimSuffix(name, "~")
+	if filepath.Ext(trimmed) != ".journal" {
+		return "", false
+	}
+	journal, _, archived := strings.Cut(strings.TrimSuffix(trimmed, ".journal"), "@")
+	return journal, archived || trimmed != name
+}
+
+// walkLogDir calls fn for every regular file below dir, staying on its filesystem
+func (s *cleanerScanner) walkLogDir(dir DirInfo, fn func(logFile)) {
+	rootInfo, err := os.Stat(dir.Path)
+	if err != nil {
+		return
+	}
+	device, deviceKnown := deviceOf(rootInfo)
+
+	filepath.WalkDir(dir.Path, func(path string, d fs.DirEntry, err error) error {
+		if s.ctx.Err() != nil {
+			return s.ctx.Err()
+		}
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			// The journal has a category of its own
+			if path != dir.Path && (path == journalLogDir || isProtectedPath(path)) {
+				return filepath.SkipDir
+			}
+			if info, err := d.Info(); err != nil || !sameDevice(info, device, deviceKnown) {
+				return filepath.SkipDir
+			}
+			s.report(path, false)
+			return nil
+		}
+		if !d.Type().IsRegular() || isProtectedPath(path) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		s.filesCounted.Add(1)
+		s.bytesFound.Add(info.Size())
+		fn(logFile{path: path, info: info})
+		return nil
+	})
+}
+
+// oldRotations keeps the newest KeepRotations files of each group and returns the rest
+func (s *cleanerScanner) oldRotations(dir DirInfo, groups map[string][]logFile) ([]FileInfo, int64) {
+	var files []FileInfo
+	var totalSize int64
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		group := groups[key]
+		sort.Slice(group, func(i, j int) bool { return group[i].info.ModTime().After(group[j].info.ModTime()) })
+
+		for i, file := range group {
+			if i < dir.rule.KeepRotations {
+				continue
+			}
+			if time.Since(file.info.ModTime()) < s.openFiles.ageGuard(dir.MinAge, file.info) {
+				continue
+			}
+
+			entry := s.logEntry(dir, file)
+			if openedBy := s.openFiles.openedBy(file.path); len(openedBy) > 0 {
+				s.addSkipped(SkippedFile{File: entry, Reason: SkipInUse, OpenedBy: openedBy})
+				continue
+			}
+			files = append(files, entry)
+			totalSize += entry.Size
+		}
+	}
+	return files, totalSize
+}
+
+func (s *cleanerScanner) logEntry(dir DirInfo, file logFile) FileInfo {
+	rel, err := filepath.Rel(dir.Path, file.path)
+	if err != nil {
+		rel = filepath.Base(file.path)
+	}
+
+	return FileInfo{
+		Path:           file.path,
+		Size:           file.info.Size(),
+		Name:           rel,
+		Location:       dir.Location,
+		NeedsElevation: dir.NeedsElevation,
+		RuleID:         dir.RuleID,
+		FileID:         registerScannedFile(dir, file.path, file.info),
+	}
+}
+
+// JournalDiskUsage returns how much space the systemd journal takes up
+func JournalDiskUsage() int64 {
+	var size int64
+	filepath.WalkDir(journalLogDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// parseByteSize parses sizes like "500MB", "1.5G" or "4096" (binary units)
+func parseByteSize(value string) (int64, error) {
+	value = strings.TrimSpace(strings.ToUpper(value))
+	if value == "" {
+		return 0, nil
+	}
+
+	number := strings.TrimRight(value, "KMGTIB ")
+	unit := strings.TrimSpace(value[len(number):])
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I")
+
+	multipliers := map[string]int64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	multiplier, exists := multipliers[unit]
+	if !exists {
+		return 0, fmt.Errorf("bad size %q", value)
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size %q", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
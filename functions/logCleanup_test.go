@@ -0,0 +1,123 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatedLogBase(t *testing.T) {
+	cases := []struct {
+		name    string
+		base    string
+		rotated bool
+	}{
+		{"syslog", "syslog", false},
+		{"syslog.1", "syslog", true},
+		{"syslog.2.gz", "syslog", true},
+		{"auth.log-20240131.gz", "auth.log", true},
+		{"Xorg.0.log", "Xorg.0.log", false},
+		{"Xorg.0.log.old", "Xorg.0.log", true},
+		{"wtmp", "wtmp", false},
+	}
+
+	for _, c := range cases {
+		base, rotated := rotatedLogBase(c.name)
+		if base != c.base || rotated != c.rotated {
+			t.Errorf("rotatedLogBase(%q) = %q, %v, want %q, %v", c.name, base, rotated, c.base, c.rotated)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]int64{"": 0, "4096": 4096, "10K": 10 << 10, "512MB": 512 << 20, "1.5GiB": 3 << 29}
+	for value, want := range cases {
+		if got, err := parseByteSize(value); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+
+	if _, err := parseByteSize("lots"); err == nil {
+		t.Errorf("Expected a bad size to be rejected")
+	}
+}
+
+func TestRotatedLogsKeepTheNewest(t *testing.T) {
+	root := t.TempDir()
+	big := make([]byte, 4096)
+	writeTestFile(t, filepath.Join(root, "syslog"), big)
+	writeTestFile(t, filepath.Join(root, "app", "app.log"), []byte("small"))
+	writeTestFile(t, filepath.Join(root, "wtmp"), big)
+
+	// Rotations of syslog, each a day older than the last
+	rotations := []string{"syslog.1", "syslog.2.gz", "syslog.3.gz", "app/app.log.1"}
+	for i, name := range rotations {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		writeTestFile(t, path, []byte("rotated"))
+		modTime := time.Now().AddDate(0, 0, -(i + 1))
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	scanner := newCleanerScanner(context.Background(), nil)
+	dir := DirInfo{Path: root, RuleID: "rotated-logs", rule: CleanerRule{KeepRotations: 1, TruncateOver: "1K"}}
+	files, _ := scanner.scanRotatedLogs(dir)
+
+	got := map[string]bool{}
+	for _, file := range files {
+		got[file.Name] = file.Truncate
+	}
+	want := map[string]bool{"syslog (truncate)": true, "syslog.2.gz": false, "syslog.3.gz": false}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for name, truncate := range want {
+		if offered, exists := got[name]; !exists || offered != truncate {
+			t.Errorf("Expected %s to be offered with truncate=%v, got %v", name, truncate, got)
+		}
+	}
+
+	dir.rule.KeepRotations = 0
+	if files, _ := scanner.scanRotatedLogs(dir); len(files) != 5 {
+		t.Errorf("Expected every rotation without keep, got: %+v", files)
+	}
+}
+
+func TestLiveLogsAreOnlyTruncated(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	live := filepath.Join(root, "syslog")
+	writeTestFile(t, live, make([]byte, 4096))
+
+	scanner := newCleanerScanner(context.Background(), nil)
+	dir := DirInfo{Path: root, RuleID: "rotated-logs", rule: CleanerRule{TruncateOver: "1K"}}
+	files, _ := scanner.scanRotatedLogs(dir)
+	if len(files) != 1 || !files[0].Truncate {
+		t.Fatalf("Expected the live log to be offered for truncation, got: %+v", files)
+	}
+
+	// Whatever the caller asks for, the live log is emptied, never removed
+	for _, mode := range []CleanMode{CleanModeDelete, CleanModeQuarantine} {
+		writeTestFile(t, live, make([]byte, 4096))
+		file := files[0]
+		file.Truncate = false
+
+		report := CleanFilesWithOptions([]FileInfo{file}, CleanOptions{Mode: mode})
+		if report.CleanedCount != 1 || report.Items[0].Status != StatusTruncated {
+			t.Fatalf("%s: expected the live log to be truncated, got: %+v", mode, report.Items)
+		}
+		if info, err := os.Lstat(live); err != nil || info.Size() != 0 {
+			t.Errorf("%s: expected an empty live log, got %v", mode, err)
+		}
+		if batches, _ := ListQuarantineBatches(); report.QuarantineBatchID != "" || len(batches) != 0 {
+			t.Errorf("%s: expected no quarantine batch for a truncation, got %q and %+v", mode, report.QuarantineBatchID, batches)
+		}
+	}
+
+	report := CleanFilesWithOptions([]FileInfo{files[0]}, CleanOptions{Mode: CleanModeCompress})
+	if report.SkippedCount != 1 || report.Items[0].Reason != SkipNotCompressible {
+		t.Errorf("Expected a live log not to be compressed, got: %+v", report.Items)
+	}
+}
@@ -0,0 +1,153 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessRef identifies a process that holds a file open
+type ProcessRef struct {
+	PID  int
+	Name string
+}
+
+// openFileIndex maps every file held open by a process to the processes holding it
+type openFileIndex struct {
+	holders map[string][]ProcessRef
+	sorted  []string
+	// partial is set when the open files of some process couldn't be read, which
+	// is the case for other users' processes unless the app runs as root
+	partial bool
+}
+
+// buildOpenFileIndex walks /proc/*/fd, /proc/*/maps and /proc/*/cwd once. It returns
+// nil where /proc can't be read (any OS but Linux, or a locked-down /proc), in which
+// case callers fall back to the modification time guard.
+func buildOpenFileIndex() *openFileIndex {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	return indexOpenFiles("/proc")
+}
+
+func indexOpenFiles(procRoot string) *openFileIndex {
+	if _, err := os.ReadDir(filepath.Join(procRoot, "self", "fd")); err != nil {
+		return nil
+	}
+
+	procs, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil
+	}
+
+	index := &openFileIndex{holders: map[string][]ProcessRef{}}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+
+		procDir := filepath.Join(procRoot, proc.Name())
+		ref := ProcessRef{PID: pid, Name: processName(procDir)}
+
+		seen := map[string]bool{}
+		add := func(path string) {
+			if !filepath.IsAbs(path) || seen[path] {
+				return
+			}
+			seen[path] = true
+			index.holders[path] = append(index.holders[path], ref)
+		}
+
+		fds, err := os.ReadDir(filepath.Join(procDir, "fd"))
+		// A process that exited meanwhile holds nothing; one we may not look at might
+		if err != nil && !os.IsNotExist(err) {
+			index.partial = true
+		}
+		if err == nil {
+			for _, fd := range fds {
+				target, err := os.Readlink(filepath.Join(procDir, "fd", fd.Name()))
+				// Sockets, pipes and unlinked files don't live at a path
+				if err != nil || strings.HasSuffix(target, " (deleted)") {
+					continue
+				}
+				add(target)
+			}
+		}
+
+		if maps, err := os.ReadFile(filepath.Join(procDir, "maps")); err == nil {
+			for _, line := range strings.Split(string(maps), "\n") {
+				// address perms offset dev inode pathname
+				fields := strings.Fields(line)
+				if len(fields) >= 6 && !strings.HasSuffix(line, " (deleted)") {
+					add(strings.Join(fields[5:], " "))
+				}
+			}
+		}
+
+		if cwd, err := os.Readlink(filepath.Join(procDir, "cwd")); err == nil {
+			add(cwd)
+		}
+	}
+
+	for path := range index.holders {
+		index.sorted = append(index.sorted, path)
+	}
+	sort.Strings(index.sorted)
+
+	return index
+}
+
+// processName reads a process's command name from /proc/<pid>/comm
+func processName(procDir string) string {
+	data, err := os.ReadFile(filepath.Join(procDir, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// openedBy returns the processes holding path, or anything below it, open
+func (idx *openFileIndex) openedBy(path string) []ProcessRef {
+	if idx == nil {
+		return nil
+	}
+
+	var refs []ProcessRef
+	seen := map[int]bool{}
+	addAll := func(holders []ProcessRef) {
+		for _, ref := range holders {
+			if !seen[ref.PID] {
+				seen[ref.PID] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	addAll(idx.holders[path])
+
+	// Every open path below a directory sorts right after its prefix
+	prefix := path + string(filepath.Separator)
+	for i := sort.SearchStrings(idx.sorted, prefix); i < len(idx.sorted) && strings.HasPrefix(idx.sorted[i], prefix); i++ {
+		addAll(idx.holders[idx.sorted[i]])
+	}
+
+	return refs
+}
+
+// ageGuard is the minimum age for the file described by info: the rule's own policy,
+// raised to the one minute fallback when open files can't be detected. With a partial
+// index that is still the case for files someone else owns, or info is nil.
+func (idx *openFileIndex) ageGuard(ruleMinAge time.Duration, info os.FileInfo) time.Duration {
+	unknown := idx == nil || (idx.partial && !ownedByCurrentUser(info))
+	if unknown && ruleMinAge < defaultMinAge {
+		return defaultMinAge
+	}
+	return ruleMinAge
+}
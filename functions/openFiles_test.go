@@ -0,0 +1,125 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestOpenFileIndexNotesUnreadableProcesses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no /proc on Windows")
+	}
+
+	proc := t.TempDir()
+	held := filepath.Join(t.TempDir(), "held.log")
+	if err := os.WriteFile(held, []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"self/fd", "100/fd"} {
+		if err := os.MkdirAll(filepath.Join(proc, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(proc, "100", "comm"), []byte("writer\n"), 0644)
+	if err := os.Symlink(held, filepath.Join(proc, "100", "fd", "3")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	index := indexOpenFiles(proc)
+	if index == nil || index.partial {
+		t.Fatalf("Expected a complete index, got %+v", index)
+	}
+	if refs := index.openedBy(held); len(refs) != 1 || refs[0].PID != 100 || refs[0].Name != "writer" {
+		t.Errorf("Expected held.log to be held by process 100, got %v", refs)
+	}
+
+	// A process whose fd directory can't be read makes the index partial; one
+	// that exited doesn't
+	os.MkdirAll(filepath.Join(proc, "200"), 0755)
+	if index := indexOpenFiles(proc); index.partial {
+		t.Errorf("Expected a process without fd directory not to count")
+	}
+	os.WriteFile(filepath.Join(proc, "200", "fd"), nil, 0644)
+	if index := indexOpenFiles(proc); !index.partial {
+		t.Errorf("Expected an unreadable fd directory to make the index partial")
+	}
+
+	if indexOpenFiles(filepath.Join(proc, "missing")) != nil {
+		t.Errorf("Expected no index without /proc/self/fd")
+	}
+}
+
+func TestAgeGuard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mine, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	complete := &openFileIndex{}
+	partial := &openFileIndex{partial: true}
+
+	// Windows has no owner to compare, so its files always get the fallback
+	ownFile := time.Duration(0)
+	if runtime.GOOS == "windows" {
+		ownFile = defaultMinAge
+	}
+
+	cases := []struct {
+		name  string
+		index *openFileIndex
+		rule  time.Duration
+		info  os.FileInfo
+		want  time.Duration
+	}{
+		{"no index", nil, 0, mine, defaultMinAge},
+		{"no index, longer rule", nil, time.Hour, mine, time.Hour},
+		{"complete index", complete, 0, nil, 0},
+		{"partial index, unknown owner", partial, 0, nil, defaultMinAge},
+		{"partial index, longer rule", partial, time.Hour, nil, time.Hour},
+		{"partial index, own file", partial, 0, mine, ownFile},
+	}
+	for _, c := range cases {
+		if got := c.index.ageGuard(c.rule, c.info); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestOpenFileIndexFindsOwnFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	path := filepath.Join(dir, "held.log")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	index := buildOpenFileIndex()
+	if index == nil {
+		t.Skip("open files can't be listed here")
+	}
+
+	// A directory is in use when anything below it is
+	for _, p := range []string{path, dir} {
+		found := false
+		for _, ref := range index.openedBy(p) {
+			found = found || ref.PID == os.Getpid()
+		}
+		if !found {
+			t.Errorf("Expected %s to be held by this process, got %v", p, index.openedBy(p))
+		}
+	}
+	if refs := index.openedBy(filepath.Join(t.TempDir(), "free.log")); len(refs) != 0 {
+		t.Errorf("Expected a closed file not to be held, got %v", refs)
+	}
+}
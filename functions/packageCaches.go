@@ -0,0 +1,387 @@
+package functions
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	pacmanConfigFile      = "/etc/pacman.conf"
+	defaultPacmanCacheDir = "/var/cache/pacman/pkg"
+)
+
+// packageCacheManagers names the package manager of each package cache rule
+var packageCacheManagers = map[string]string{
+	"apt-cache":    "apt",
+	"dnf-cache":    "dnf",
+	"pacman-cache": "pacman",
+	"zypper-cache": "zypper",
+}
+
+// PackageCacheUsage sums up the caches of one package manager. Caches that need
+// elevation are still measured where they can be read, so the space can be shown
+// before the app is restarted with more privileges.
+type PackageCacheUsage struct {
+	Manager  string   `json:"manager"`
+	Category string   `json:"category"`
+	Paths    []string `json:"paths"`
+	Size     int64    `json:"size"`
+	// ReclaimableSize is what the rule would offer, e.g. all but the newest pacman packages
+	ReclaimableSize   int64 `json:"reclaimableSize"`
+	RequiresElevation bool  `json:"requiresElevation"`
+}
+
+// pacmanPackage is a package file of the pacman cache
+type pacmanPackage struct {
+	file    string
+	name    string
+	version string
+	arch    string
+}
+
+// pacmanCacheDirs returns the CacheDir entries of pacman.conf, or pacman's default
+func pacmanCacheDirs() []string {
+	f, err := os.Open(pacmanConfigFile)
+	if err != nil {
+		return []string{defaultPacmanCacheDir}
+	}
+	defer f.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found || strings.TrimSpace(key) != "CacheDir" {
+			continue
+		}
+		// CacheDir takes a space separated list and may be repeated
+		dirs = append(dirs, strings.Fields(value)...)
+	}
+
+	if len(dirs) == 0 {
+		return []string{defaultPacmanCacheDir}
+	}
+	return dirs
+}
+
+// parsePacmanPackage splits a file name like "linux-6.9.1.arch1-1-x86_64.pkg.tar.zst"
+// into package name, [epoch:]version-release and architecture
+func parsePacmanPackage(file string) (pacmanPackage, bool) {
+	base, _, found := strings.Cut(file, ".pkg.tar")
+	if !found || strings.HasSuffix(file, ".sig") || strings.HasSuffix(file, ".part") {
+		return pacmanPackage{}, false
+	}
+
+	parts := strings.Split(base, "-")
+	if len(parts) < 4 {
+		return pacmanPackage{}, false
+	}
+	n := len(parts)
+	return pacmanPackage{
+		file:    file,
+		name:    strings.Join(parts[:n-3], "-"),
+		version: parts[n-3] + "-" + parts[n-2],
+		arch:    parts[n-1],
+	}, true
+}
+
+// pacmanOldPackages returns the package files, and their signatures, beyond the newest
+// keep versions of each package and architecture, like paccache -rk<keep>
+func pacmanOldPackages(files []string, keep int) []string {
+	present := map[string]bool{}
+	groups := map[string][]pacmanPackage{}
+	for _, file := range files {
+		present[file] = true
+		if pkg, ok := parsePacmanPackage(file); ok {
+			key := pkg.name + "/" + pkg.arch
+			groups[key] = append(groups[key], pkg)
+		}
+	}
+
+	var old []string
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return pacmanVercmp(group[i].version, group[j].version) > 0 })
+		for i, pkg := range group {
+			if i < keep {
+				continue
+			}
+			old = append(old, pkg.file)
+			if present[pkg.file+".sig"] {
+				old = append(old, pkg.file+".sig")
+			}
+		}
+	}
+
+	sort.Strings(old)
+	return old
+}
+
+// pacmanVercmp compares two [epoch:]version[-release] strings the way libalpm does
+func pacmanVercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	epochA, versionA, releaseA := splitPacmanVersion(a)
+	epochB, versionB, releaseB := splitPacmanVersion(b)
+
+	if ret := rpmvercmp(epochA, epochB); ret != 0 {
+		return ret
+	}
+	if ret := rpmvercmp(versionA, versionB); ret != 0 {
+		return ret
+	}
+	// A missing release matches any release
+	if releaseA != "" && releaseB != "" {
+		return rpmvercmp(releaseA, releaseB)
+	}
+	return 0
+}
+
+func splitPacmanVersion(evr string) (epoch, version, release string) {
+	epoch = "0"
+	digits := 0
+	for digits < len(evr) && isDigit(evr[digits]) {
+		digits++
+	}
+	if digits < len(evr) && evr[digits] == ':' {
+		if digits > 0 {
+			epoch = evr[:digits]
+		}
+		evr = evr[digits+1:]
+	}
+
+	if i := strings.LastIndexByte(evr, '-'); i >= 0 {
+		return epoch, evr[:i], evr[i+1:]
+	}
+	return epoch, evr, ""
+}
+
+// rpmvercmp compares version segments: runs of digits numerically, runs of letters
+// lexically, with numbers newer than letters and separators only counting by length
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	one, two := 0, 0
+	for one < len(a) && two < len(b) {
+		start1, start2 := one, two
+		for one < len(a) && !isAlnum(a[one]) {
+			one++
+		}
+		for two < len(b) && !isAlnum(b[two]) {
+			two++
+		}
+		if one == len(a) || two == len(b) {
+			break
+		}
+
+		// Different separator lengths decide on their own
+		if one-start1 != two-start2 {
+			if one-start1 < two-start2 {
+				return -1
+			}
+			return 1
+		}
+
+		end1, end2 := one, two
+		isNum := isDigit(a[one])
+		if isNum {
+			for end1 < len(a) && isDigit(a[end1]) {
+				end1++
+			}
+			for end2 < len(b) && isDigit(b[end2]) {
+				end2++
+			}
+		} else {
+			for end1 < len(a) && isAlpha(a[end1]) {
+				end1++
+			}
+			for end2 < len(b) && isAlpha(b[end2]) {
+				end2++
+			}
+		}
+
+		// Segments of different types: a number is newer
+		if end2 == two {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+
+		seg1, seg2 := a[one:end1], b[two:end2]
+		if isNum {
+			seg1, seg2 = strings.TrimLeft(seg1, "0"), strings.TrimLeft(seg2, "0")
+			if len(seg1) != len(seg2) {
+				if len(seg1) > len(seg2) {
+					return 1
+				}
+				return -1
+			}
+		}
+		if cmp := strings.Compare(seg1, seg2); cmp != 0 {
+			return cmp
+		}
+
+		one, two = end1, end2
+	}
+
+	if one == len(a) && two == len(b) {
+		return 0
+	}
+	// A remaining letter segment never beats an empty one
+	if (one == len(a) && !isAlpha(b[two])) || (one < len(a) && isAlpha(a[one])) {
+		return -1
+	}
+	return 1
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isAlpha(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+func isAlnum(c byte) bool { return isDigit(c) || isAlpha(c) }
+
+// scanPacmanCache offers the packages beyond the newest KeepVersions of each package
+func (s *cleanerScanner) scanPacmanCache(dir DirInfo) ([]FileInfo, int64) {
+	var files []FileInfo
+	var totalSize int64
+
+	entries, err := os.ReadDir(dir.Path)
+	if err != nil {
+		return files, 0
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	for _, name := range pacmanOldPackages(names, dir.rule.KeepVersions) {
+		if s.ctx.Err() != nil {
+			break
+		}
+
+		path := filepath.Join(dir.Path, name)
+		if isProtectedPath(path) {
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		s.filesCounted.Add(1)
+		s.bytesFound.Add(info.Size())
+
+		if time.Since(info.ModTime()) < s.openFiles.ageGuard(dir.MinAge, info) {
+			continue
+		}
+
+		entry := FileInfo{
+			Path:           path,
+			Size:           info.Size(),
+			Name:           name,
+			Location:       dir.Location,
+			NeedsElevation: dir.NeedsElevation,
+			RuleID:         dir.RuleID,
+			FileID:         registerScannedFile(dir, path, info),
+		}
+		if openedBy := s.openFiles.openedBy(path); len(openedBy) > 0 {
+			s.addSkipped(SkippedFile{File: entry, Reason: SkipInUse, OpenedBy: openedBy})
+			continue
+		}
+		files = append(files, entry)
+		totalSize += entry.Size
+	}
+
+	return files, totalSize
+}
+
+// measurePackageCache returns the size of a package cache and how much of it the
+// rule would offer, reading whatever is readable without elevation
+func measurePackageCache(dir DirInfo) (int64, int64) {
+	entries, err := os.ReadDir(dir.Path)
+	if err != nil {
+		return 0, 0
+	}
+
+	var size, reclaimable int64
+	sizes := map[string]int64{}
+	var names []string
+	for _, entry := range entries {
+		entrySize := treeSize(filepath.Join(dir.Path, entry.Name()))
+		size += entrySize
+		sizes[entry.Name()] = entrySize
+		names = append(names, entry.Name())
+
+		if dir.rule.Provider != "pacman-cache" && dir.rule.matches(entry.Name()) {
+			reclaimable += entrySize
+		}
+	}
+
+	if dir.rule.Provider == "pacman-cache" {
+		for _, name := range pacmanOldPackages(names, dir.rule.KeepVersions) {
+			reclaimable += sizes[name]
+		}
+	}
+	return size, reclaimable
+}
+
+// treeSize sums the regular files below path, ignoring what can't be read
+func treeSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// addPackageCacheUsage adds a package cache directory to its manager's totals. For
+// directories that were scanned, reclaimable is what the scan offered.
+func (r *CleanerResult) addPackageCacheUsage(dir DirInfo, reclaimable int64, scanned bool) {
+	manager, exists := packageCacheManagers[dir.RuleID]
+	if !exists {
+		return
+	}
+
+	size, measured := measurePackageCache(dir)
+	if !scanned {
+		reclaimable = measured
+	}
+
+	for i := range r.PackageCaches {
+		usage := &r.PackageCaches[i]
+		if usage.Manager == manager {
+			usage.Paths = append(usage.Paths, dir.Path)
+			usage.Size += size
+			usage.ReclaimableSize += reclaimable
+			usage.RequiresElevation = usage.RequiresElevation || !scanned
+			return
+		}
+	}
+
+	r.PackageCaches = append(r.PackageCaches, PackageCacheUsage{
+		Manager:           manager,
+		Category:          dir.Location,
+		Paths:             []string{dir.Path},
+		Size:              size,
+		ReclaimableSize:   reclaimable,
+		RequiresElevation: !scanned,
+	})
+}
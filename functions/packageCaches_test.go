@@ -0,0 +1,75 @@
+package functions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPacmanVercmp(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0-1", "1.0-1", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-1", "1.0.1-1", -1},
+		{"1.0.0", "1.0", 1},
+		{"1.0a", "1.0", -1},
+		{"1.0a", "1.0b", -1},
+		{"1.0alpha", "1.0.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.001", "1.1", 0},
+		{"1:1.0-1", "2.0-1", 1},
+		{"0:2.0-1", "2.0-1", 0},
+		{"1.0", "1.0-5", 0},
+		{"1.0..1", "1.0.1", 1},
+		{"6.9.1.arch1-1", "6.10.arch1-1", -1},
+	}
+
+	for _, c := range cases {
+		if got := pacmanVercmp(c.a, c.b); got != c.want {
+			t.Errorf("pacmanVercmp(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+		if got := pacmanVercmp(c.b, c.a); got != -c.want {
+			t.Errorf("pacmanVercmp(%q, %q) = %d, want %d", c.b, c.a, got, -c.want)
+		}
+	}
+}
+
+func TestPacmanOldPackages(t *testing.T) {
+	files := []string{
+		"linux-6.9.1.arch1-1-x86_64.pkg.tar.zst",
+		"linux-6.9.1.arch1-1-x86_64.pkg.tar.zst.sig",
+		"linux-6.10.arch1-1-x86_64.pkg.tar.zst",
+		"linux-6.8.9.arch1-2-x86_64.pkg.tar.zst",
+		"linux-6.8.9.arch1-2-x86_64.pkg.tar.zst.sig",
+		"linux-firmware-20240510.1-1-any.pkg.tar.zst",
+		"linux-firmware-20240409.1-1-any.pkg.tar.zst",
+		"python-3.12.3-1-x86_64.pkg.tar.xz",
+		"python-1:3.11.0-1-x86_64.pkg.tar.xz",
+		"download-abc123",
+		"linux-6.11.arch1-1-x86_64.pkg.tar.zst.part",
+	}
+
+	got := pacmanOldPackages(files, 2)
+	want := []string{
+		"linux-6.8.9.arch1-2-x86_64.pkg.tar.zst",
+		"linux-6.8.9.arch1-2-x86_64.pkg.tar.zst.sig",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keep 2: got %v, want %v", got, want)
+	}
+
+	got = pacmanOldPackages(files, 1)
+	want = []string{
+		"linux-6.8.9.arch1-2-x86_64.pkg.tar.zst",
+		"linux-6.8.9.arch1-2-x86_64.pkg.tar.zst.sig",
+		"linux-6.9.1.arch1-1-x86_64.pkg.tar.zst",
+		"linux-6.9.1.arch1-1-x86_64.pkg.tar.zst.sig",
+		"linux-firmware-20240409.1-1-any.pkg.tar.zst",
+		"python-3.12.3-1-x86_64.pkg.tar.xz",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keep 1: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,332 @@
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const userProtectionFile = "protection.json"
+
+// ProtectionAction is what a protection rule does to the paths it matches
+type ProtectionAction string
+
+const (
+	ProtectionProtect ProtectionAction = "protect"
+	ProtectionAllow   ProtectionAction = "allow"
+)
+
+// ProtectionRule keeps paths out of (or, for allow rules, back into) scans and cleaning.
+//
+// A pattern starting with / (or ~, or a variable) is anchored: it matches that path and
+// everything below it. Any other pattern matches a run of path components anywhere, so
+// "node_modules" protects every node_modules directory. Each component may be a glob.
+type ProtectionRule struct {
+	Pattern string           `json:"pattern"`
+	Action  ProtectionAction `json:"action"`
+	BuiltIn bool             `json:"builtIn"`
+	OS      []string         `json:"os,omitempty"`
+}
+
+// ProtectionSettings are the user's exclusions and pinned allow-paths
+type ProtectionSettings struct {
+	Exclusions []string `json:"exclusions"`
+	AllowPaths []string `json:"allowPaths"`
+}
+
+// builtInProtection can't be overridden by allow-paths
+var builtInProtection = []ProtectionRule{
+	{Pattern: "/proc", OS: []string{"linux"}},
+	{Pattern: "/sys", OS: []string{"linux"}},
+	{Pattern: "/dev", OS: []string{"linux", "darwin"}},
+	{Pattern: "/boot", OS: []string{"linux"}},
+	{Pattern: "/System", OS: []string{"darwin"}},
+	{Pattern: "${SystemRoot}/System32", OS: []string{"windows"}},
+	{Pattern: "System Volume Information"},
+	{Pattern: "$Recycle.Bin"},
+	{Pattern: "pagefile.sys"},
+	{Pattern: "hiberfil.sys"},
+	{Pattern: "swapfile.sys"},
+}
+
+// compiledProtection is a rule with its pattern split into components
+type compiledProtection struct {
+	rule       ProtectionRule
+	anchored   bool
+	components []string
+}
+
+// activeProtection caches the compiled rules; it is reset whenever the settings are saved
+var activeProtection struct {
+	sync.Mutex
+	rules []compiledProtection
+}
+
+// GetProtectionRules returns the built-in rules followed by the user's
+func GetProtectionRules() ([]ProtectionRule, error) {
+	var rules []ProtectionRule
+	for _, rule := range builtInProtection {
+		rule.Action = ProtectionProtect
+		rule.BuiltIn = true
+		rules = append(rules, rule)
+	}
+
+	settings, err := LoadProtectionSettings()
+	for _, pattern := range settings.Exclusions {
+		rules = append(rules, ProtectionRule{Pattern: pattern, Action: ProtectionProtect})
+	}
+	for _, pattern := range settings.AllowPaths {
+		rules = append(rules, ProtectionRule{Pattern: pattern, Action: ProtectionAllow})
+	}
+	return rules, err
+}
+
+// LoadProtectionSettings reads the user's exclusions and allow-paths
+func LoadProtectionSettings() (ProtectionSettings, error) {
+	settings := ProtectionSettings{Exclusions: []string{}, AllowPaths: []string{}}
+
+	path, err := ProtectionSettingsPath()
+	if err != nil {
+		return settings, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("error decoding %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// SaveProtectionSettings validates and stores the user's exclusions and allow-paths
+func SaveProtectionSettings(settings ProtectionSettings) error {
+	for _, pattern := range append(append([]string{}, settings.Exclusions...), settings.AllowPaths...) {
+		if _, err := compileProtection(ProtectionRule{Pattern: pattern}); err != nil {
+			return err
+		}
+	}
+	if settings.Exclusions == nil {
+		settings.Exclusions = []string{}
+	}
+	if settings.AllowPaths == nil {
+		settings.AllowPaths = []string{}
+	}
+
+	path, err := ProtectionSettingsPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+
+	activeProtection.Lock()
+	activeProtection.rules = nil
+	activeProtection.Unlock()
+
+	// Cached sizes leave out what was protected when they were taken
+	openScanCache(true)
+	return nil
+}
+
+// ProtectionSettingsPath returns where the user's exclusions and allow-paths are stored
+func ProtectionSettingsPath() (string, error) {
+	dir, err := appConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, userProtectionFile), nil
+}
+
+// ExplainProtection returns the rule that keeps path out of scans, if any
+func ExplainProtection(path string) (*ProtectionRule, bool) {
+	return protectionFor(path)
+}
+
+// protectionFor returns the rule protecting path. Built-in rules always win; among
+// the user's rules the one matching closest to path decides, and exclusions win ties.
+func protectionFor(path string) (*ProtectionRule, bool) {
+	components := pathComponents(filepath.Clean(path))
+
+	var best *ProtectionRule
+	bestDepth := -1
+	for _, rule := range loadedProtection() {
+		depth := rule.matchDepth(components)
+		if depth < 0 {
+			continue
+		}
+		if rule.rule.BuiltIn {
+			found := rule.rule
+			return &found, true
+		}
+		if depth > bestDepth || (depth == bestDepth && rule.rule.Action == ProtectionProtect) {
+			found := rule.rule
+			best, bestDepth = &found, depth
+		}
+	}
+
+	if best == nil || best.Action != ProtectionProtect {
+		return nil, false
+	}
+	return best, true
+}
+
+// protectionBelow returns the rule protecting path or anything below it. Symlinks
+// aren't followed, so this covers exactly what removing path would delete.
+func protectionBelow(path string) (*ProtectionRule, bool) {
+	var found *ProtectionRule
+	filepath.WalkDir(path, func(p string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if rule, protected := protectionFor(p); protected {
+			found = rule
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found, found != nil
+}
+
+// isProtectedPath reports whether path must never be scanned or cleaned
+func isProtectedPath(path string) bool {
+	_, protected := protectionFor(path)
+	return protected
+}
+
+// protectionSkipReason tells built-in protection apart from the user's exclusions
+func protectionSkipReason(rule *ProtectionRule) SkipReason {
+	if rule.BuiltIn {
+		return SkipCriticalFile
+	}
+	return SkipUserExcluded
+}
+
+func loadedProtection() []compiledProtection {
+	activeProtection.Lock()
+	defer activeProtection.Unlock()
+
+	if activeProtection.rules != nil {
+		return activeProtection.rules
+	}
+
+	// A broken settings file still leaves the built-in rules in force
+	rules, _ := GetProtectionRules()
+	compiled := []compiledProtection{}
+	for _, rule := range rules {
+		if !appliesToOS(rule.OS) {
+			continue
+		}
+		if c, err := compileProtection(rule); err == nil {
+			compiled = append(compiled, c)
+		}
+	}
+
+	activeProtection.rules = compiled
+	return compiled
+}
+
+func compileProtection(rule ProtectionRule) (compiledProtection, error) {
+	pattern := strings.TrimSpace(rule.Pattern)
+	if pattern == "" {
+		return compiledProtection{}, errors.New("empty protection pattern")
+	}
+
+	// Only ${VAR} is a variable, so names like $Recycle.Bin stay plain components
+	anchored := strings.HasPrefix(pattern, "~") || strings.HasPrefix(pattern, "${") ||
+		strings.HasPrefix(pattern, "/") || filepath.IsAbs(pattern)
+
+	if pattern == "~" || strings.HasPrefix(pattern, "~/") {
+		home := userHomeDir()
+		if home == "" {
+			return compiledProtection{}, fmt.Errorf("no home directory for %q", rule.Pattern)
+		}
+		pattern = home + pattern[1:]
+	}
+	if strings.Contains(pattern, "${") {
+		missing := false
+		pattern = os.Expand(pattern, func(name string) string {
+			value := rulePathVar(name)
+			if value == "" {
+				missing = true
+			}
+			return value
+		})
+		if missing {
+			return compiledProtection{}, fmt.Errorf("unknown variable in %q", rule.Pattern)
+		}
+	}
+
+	components := pathComponents(filepath.Clean(filepath.FromSlash(pattern)))
+	if len(components) == 0 {
+		return compiledProtection{}, fmt.Errorf("protection pattern %q matches everything", rule.Pattern)
+	}
+	for _, component := range components {
+		if _, err := filepath.Match(component, ""); err != nil {
+			return compiledProtection{}, fmt.Errorf("bad protection pattern %q: %w", rule.Pattern, err)
+		}
+	}
+
+	return compiledProtection{rule: rule, anchored: anchored, components: components}, nil
+}
+
+// matchDepth returns how many components of path lead up to the deepest match of the
+// rule: at the start of path for anchored rules, anywhere for the others. It is -1
+// when the rule doesn't match.
+func (c compiledProtection) matchDepth(path []string) int {
+	last := len(path) - len(c.components)
+	if c.anchored {
+		last = min(last, 0)
+	}
+
+	for start := last; start >= 0; start-- {
+		matched := true
+		for i, component := range c.components {
+			if ok, _ := filepath.Match(component, path[start+i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return start + len(c.components)
+		}
+	}
+	return -1
+}
+
+// pathComponents splits a cleaned path into its components, with the volume as the
+// first one on Windows. Names are compared case-insensitively where the OS does.
+func pathComponents(path string) []string {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		path = strings.ToLower(path)
+	}
+
+	volume := filepath.VolumeName(path)
+	var components []string
+	if volume != "" {
+		components = append(components, volume)
+	}
+	for _, component := range strings.Split(path[len(volume):], string(filepath.Separator)) {
+		if component != "" && component != "." {
+			components = append(components, component)
+		}
+	}
+	return components
+}
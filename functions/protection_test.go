@@ -0,0 +1,90 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestProtectionMatchesPathComponents(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("APPDATA", configDir)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	settings := ProtectionSettings{
+		Exclusions: []string{"~/projects", "*.keep"},
+		AllowPaths: []string{"~/projects/scratch"},
+	}
+	if err := SaveProtectionSettings(settings); err != nil {
+		t.Fatalf("Expected settings to save, got: %v", err)
+	}
+	t.Cleanup(func() { SaveProtectionSettings(ProtectionSettings{}) })
+
+	cases := map[string]bool{
+		filepath.Join(home, ".cache", "dev-tools"):              false,
+		filepath.Join(home, "sysroot"):                          false,
+		filepath.Join(home, "projects", "app"):                  true,
+		filepath.Join(home, "projects", "scratch", "out"):       false,
+		filepath.Join(home, "projects", "scratch", "data.keep"): true,
+		filepath.Join(home, "old", "System Volume Information"): true,
+		filepath.Join(home, "pagefile.sys.bak"):                 false,
+	}
+	if runtime.GOOS == "linux" {
+		cases["/proc/1/fd"] = true
+		cases["/tmp/sysroot"] = false
+		cases["/tmp/proc"] = false
+	}
+
+	for path, want := range cases {
+		rule, protected := protectionFor(path)
+		if protected != want {
+			t.Errorf("protectionFor(%s) = %v (%+v), want %v", path, protected, rule, want)
+		}
+	}
+
+	if rule, _ := protectionFor(filepath.Join(home, "projects", "app")); rule == nil || rule.Pattern != "~/projects" || rule.BuiltIn {
+		t.Errorf("Expected the user exclusion to be reported, got: %+v", rule)
+	}
+
+	if err := SaveProtectionSettings(ProtectionSettings{Exclusions: []string{"["}}); err == nil {
+		t.Errorf("Expected a bad pattern to be rejected")
+	}
+}
+
+func TestProtectedDescendants(t *testing.T) {
+	useTempAppData(t)
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("APPDATA", configDir)
+
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	kept := filepath.Join(app, "sub", "keep.db")
+	writeTestFile(t, filepath.Join(app, "blob.bin"), make([]byte, 100))
+	writeTestFile(t, kept, make([]byte, 400))
+	backdate(t, filepath.Join(app, "blob.bin"), kept, filepath.Join(app, "sub"), app)
+
+	if err := SaveProtectionSettings(ProtectionSettings{Exclusions: []string{kept}}); err != nil {
+		t.Fatalf("Expected settings to save, got: %v", err)
+	}
+	t.Cleanup(func() { SaveProtectionSettings(ProtectionSettings{}) })
+
+	scanner := newCleanerScanner(context.Background(), nil)
+	got, total := scanner.scanDirectory(DirInfo{Path: root})
+	if total != 100 || len(got) != 1 || got[0].Size != 100 {
+		t.Fatalf("Expected the protected file to be left out of the size, got %d bytes in %+v", total, got)
+	}
+
+	report := CleanFilesWithOptions(got, CleanOptions{})
+	if len(report.Items) != 1 || report.Items[0].Status != StatusSkipped || report.Items[0].Reason != SkipUserExcluded {
+		t.Errorf("Expected the directory holding the protected file to be skipped, got: %+v", report.Items)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("Expected the protected file to survive, got: %v", err)
+	}
+}
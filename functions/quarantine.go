@@ -0,0 +1,322 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const quarantineManifestName = "manifest.json"
+
+// QuarantineItem is a single file or folder moved into quarantine
+type QuarantineItem struct {
+	ID            string
+	OriginalPath  string
+	Size          int64
+	Mode          os.FileMode
+	Category      string
+	QuarantinedAt time.Time
+	Restored      bool
+}
+
+// QuarantineBatch groups the items quarantined by one clean run
+type QuarantineBatch struct {
+	ID        string
+	CreatedAt time.Time
+	Items     []QuarantineItem
+	TotalSize int64
+}
+
+// quarantineMu serializes manifest reads and writes
+var quarantineMu sync.Mutex
+
+func quarantineRoot() (string, error) {
+	dataDir, err := appDataDir()
+	if err != nil {
+		return "", err
+	}
+
+	root := filepath.Join(dataDir, "quarantine")
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", err
+	}
+	return root, nil
+}
+
+// newQuarantineBatch creates an empty batch directory and manifest
+func newQuarantineBatch() (*QuarantineBatch, string, error) {
+	root, err := quarantineRoot()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	batch := &QuarantineBatch{
+		ID:        fmt.Sprintf("%s-%09d", now.Format("20060102-150405"), now.Nanosecond()),
+		CreatedAt: now,
+		Items:     []QuarantineItem{},
+	}
+
+	batchDir := filepath.Join(root, batch.ID)
+	if err := os.MkdirAll(filepath.Join(batchDir, "files"), 0700); err != nil {
+		return nil, "", err
+	}
+
+	if err := writeQuarantineManifest(batchDir, batch); err != nil {
+		return nil, "", err
+	}
+	return batch, batchDir, nil
+}
+
+// quarantineMove is moveFile, replaceable in tests
+var quarantineMove = moveFile
+
+// quarantineFile moves a file into the batch and records it in the manifest. The
+// item is recorded before the move, so a copy between devices whose source can't
+// be removed afterwards is still listed and restorable rather than left behind.
+func quarantineFile(batch *QuarantineBatch, batchDir string, file FileInfo) error {
+	info, err := os.Lstat(file.Path)
+	if err != nil {
+		return err
+	}
+
+	item := QuarantineItem{
+		ID:            fmt.Sprintf("%04d", len(batch.Items)+1),
+		OriginalPath:  file.Path,
+		Size:          file.Size,
+		Mode:          info.Mode(),
+		Category:      file.Location,
+		QuarantinedAt: time.Now(),
+	}
+	dst := filepath.Join(batchDir, "files", item.ID)
+
+	if err := recordQuarantineItem(batchDir, batch, item); err != nil {
+		return err
+	}
+
+	moveErr := quarantineMove(file.Path, dst)
+	if moveErr == nil {
+		return nil
+	}
+
+	// Nothing arrived in the batch, so there is nothing to list
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		if err := dropQuarantineItem(batchDir, batch, item.ID); err != nil {
+			return fmt.Errorf("%w (and the manifest could not be updated: %v)", moveErr, err)
+		}
+	}
+	return moveErr
+}
+
+func recordQuarantineItem(batchDir string, batch *QuarantineBatch, item QuarantineItem) error {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+
+	batch.Items = append(batch.Items, item)
+	batch.TotalSize += item.Size
+	if err := writeQuarantineManifest(batchDir, batch); err != nil {
+		batch.Items = batch.Items[:len(batch.Items)-1]
+		batch.TotalSize -= item.Size
+		return err
+	}
+	return nil
+}
+
+func dropQuarantineItem(batchDir string, batch *QuarantineBatch, id string) error {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+
+	for i, item := range batch.Items {
+		if item.ID == id {
+			batch.Items = append(batch.Items[:i], batch.Items[i+1:]...)
+			batch.TotalSize -= item.Size
+			break
+		}
+	}
+	return writeQuarantineManifest(batchDir, batch)
+}
+
+func writeQuarantineManifest(batchDir string, batch *QuarantineBatch) error {
+	data, err := json.MarshalIndent(batch, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(batchDir, quarantineManifestName), data)
+}
+
+func readQuarantineManifest(batchDir string) (*QuarantineBatch, error) {
+	data, err := os.ReadFile(filepath.Join(batchDir, quarantineManifestName))
+	if err != nil {
+		return nil, err
+	}
+
+	var batch QuarantineBatch
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("error decoding quarantine manifest: %w", err)
+	}
+	return &batch, nil
+}
+
+// ListQuarantineBatches returns all quarantine batches, newest first
+func ListQuarantineBatches() ([]QuarantineBatch, error) {
+	root, err := quarantineRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+
+	batches := []QuarantineBatch{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		batch, err := readQuarantineManifest(filepath.Join(root, entry.Name()))
+		if err != nil {
+			continue
+		}
+		batches = append(batches, *batch)
+	}
+
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].CreatedAt.After(batches[j].CreatedAt)
+	})
+
+	return batches, nil
+}
+
+// RestoreQuarantineBatch restores every item of a batch to its original path
+func RestoreQuarantineBatch(batchID string) (int, []string) {
+	return RestoreQuarantineItems(batchID, nil)
+}
+
+// RestoreQuarantineItems restores the given items of a batch to their original paths.
+// A nil itemIDs restores every item that has not been restored yet.
+func RestoreQuarantineItems(batchID string, itemIDs []string) (int, []string) {
+	failures := []string{}
+
+	batchDir, err := quarantineBatchDir(batchID)
+	if err != nil {
+		return 0, append(failures, err.Error())
+	}
+
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+
+	batch, err := readQuarantineManifest(batchDir)
+	if err != nil {
+		return 0, append(failures, fmt.Sprintf("Failed to read batch %s (Error: %s)", batchID, err))
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range itemIDs {
+		wanted[id] = true
+	}
+
+	restored := 0
+	for i := range batch.Items {
+		item := &batch.Items[i]
+		if item.Restored || (itemIDs != nil && !wanted[item.ID]) {
+			continue
+		}
+
+		if _, err := os.Lstat(item.OriginalPath); err == nil {
+			failures = append(failures, fmt.Sprintf("Skipped (path already exists): %s", item.OriginalPath))
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(item.OriginalPath), 0755); err != nil {
+			failures = append(failures, fmt.Sprintf("Failed to restore: %s (Error: %s)", item.OriginalPath, err))
+			continue
+		}
+
+		if err := moveFile(filepath.Join(batchDir, "files", item.ID), item.OriginalPath); err != nil {
+			failures = append(failures, fmt.Sprintf("Failed to restore: %s (Error: %s)", item.OriginalPath, err))
+			continue
+		}
+
+		os.Chmod(item.OriginalPath, item.Mode.Perm())
+		item.Restored = true
+		restored++
+	}
+
+	// Drop the batch once nothing is left in it
+	allRestored := true
+	for _, item := range batch.Items {
+		if !item.Restored {
+			allRestored = false
+			break
+		}
+	}
+
+	if allRestored {
+		os.RemoveAll(batchDir)
+	} else if err := writeQuarantineManifest(batchDir, batch); err != nil {
+		failures = append(failures, fmt.Sprintf("Failed to update batch %s (Error: %s)", batchID, err))
+	}
+
+	return restored, failures
+}
+
+// PurgeQuarantine permanently deletes batches older than maxAge and returns
+// how many batches and bytes were removed
+func PurgeQuarantine(maxAge time.Duration) (int, int64, error) {
+	batches, err := ListQuarantineBatches()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	root, err := quarantineRoot()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+
+	purged := 0
+	purgedSize := int64(0)
+	for _, batch := range batches {
+		if time.Since(batch.CreatedAt) < maxAge {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(root, batch.ID)); err != nil {
+			return purged, purgedSize, fmt.Errorf("error purging batch %s: %w", batch.ID, err)
+		}
+
+		purged++
+		for _, item := range batch.Items {
+			if !item.Restored {
+				purgedSize += item.Size
+			}
+		}
+	}
+
+	return purged, purgedSize, nil
+}
+
+func quarantineBatchDir(batchID string) (string, error) {
+	// Batch IDs are plain names, never paths
+	if batchID == "" || batchID != filepath.Base(batchID) || batchID == "." || batchID == ".." {
+		return "", fmt.Errorf("invalid quarantine batch id: %q", batchID)
+	}
+
+	root, err := quarantineRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, batchID), nil
+}
@@ -0,0 +1,87 @@
+package functions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuarantineAndRestore(t *testing.T) {
+	useTempAppData(t)
+
+	dir := filepath.Join(t.TempDir(), "cache-entry")
+	writeTestFile(t, filepath.Join(dir, "sub", "data"), []byte("hello"))
+	backdate(t, dir)
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerScannedFile(DirInfo{Path: filepath.Dir(dir)}, dir, info)
+
+	summary := CleanFilesWithOptions([]FileInfo{{Path: dir, Size: 5, Location: "Test"}}, CleanOptions{Mode: CleanModeQuarantine})
+	if summary.CleanedCount != 1 || summary.QuarantineBatchID == "" {
+		t.Fatalf("Expected one quarantined item, got: %+v", summary)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be moved away, got: %v", dir, err)
+	}
+
+	restored, failures := RestoreQuarantineBatch(summary.QuarantineBatchID)
+	if restored != 1 || len(failures) != 0 {
+		t.Fatalf("Expected one restored item, got %d (failures: %v)", restored, failures)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "sub", "data"))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("Expected restored file contents, got %q (%v)", data, err)
+	}
+}
+
+func TestFailedQuarantineMovesAreRecordedOrDropped(t *testing.T) {
+	useTempAppData(t)
+
+	src := filepath.Join(t.TempDir(), "cache.bin")
+	writeTestFile(t, src, []byte("data"))
+
+	saved := quarantineMove
+	defer func() { quarantineMove = saved }()
+
+	cases := []struct {
+		name string
+		// copied means the move got as far as copying src into the batch
+		copied bool
+		items  int
+	}{
+		{"nothing moved", false, 0},
+		{"copied but source left", true, 1},
+	}
+
+	for _, c := range cases {
+		quarantineMove = func(src, dst string) error {
+			if c.copied {
+				if err := copyPath(src, dst); err != nil {
+					return err
+				}
+			}
+			return errors.New("simulated failure")
+		}
+
+		batch, batchDir, err := newQuarantineBatch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := quarantineFile(batch, batchDir, FileInfo{Path: src, Size: 4}); err == nil {
+			t.Errorf("%s: expected the failure to be reported", c.name)
+		}
+
+		manifest, err := readQuarantineManifest(batchDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(manifest.Items) != c.items || manifest.TotalSize != int64(4*c.items) {
+			t.Errorf("%s: expected %d items in the manifest, got: %+v", c.name, c.items, manifest)
+		}
+	}
+}
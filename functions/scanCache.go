@@ -0,0 +1,179 @@
+package functions
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	scanCacheFile    = "scan-cache.json"
+	scanCacheVersion = 1
+	// scanCacheMaxAge bounds how stale a size can get: files that grow in place
+	// don't change their directory's mtime, so entries are rewalked after this long
+	scanCacheMaxAge = 24 * time.Hour
+	// Directories changed this close to the scan aren't cached, since another
+	// change within the filesystem's timestamp granularity would go unnoticed
+	scanCacheRacyWindow = 2 * time.Second
+)
+
+// ScanOptions configures a cleaner scan
+type ScanOptions struct {
+	// ForceRescan ignores the scan cache and walks every directory again
+	ForceRescan bool `json:"forceRescan"`
+}
+
+// scanCacheEntry is what a walk found directly in one directory. It stays valid as
+// long as the directory has the same inode and mtime, which change whenever an entry
+// is created, removed or renamed in it.
+type scanCacheEntry struct {
+	Inode   uint64 `json:"inode"`
+	ModTime int64  `json:"modTime"`
+	// Files and Size count the entries that aren't directories
+	Files int64    `json:"files"`
+	Size  int64    `json:"size"`
+	Dirs  []string `json:"dirs"`
+	// Walked is when the directory was last read, in Unix seconds
+	Walked int64 `json:"walked"`
+}
+
+// scanCache holds the directory listings of earlier cleaner scans, keyed by path,
+// so that a rescan only reads directories that changed. A nil cache caches nothing.
+type scanCache struct {
+	mu      sync.Mutex
+	entries map[string]scanCacheEntry
+	dirty   bool
+}
+
+type scanCacheFileData struct {
+	Version int                       `json:"version"`
+	Entries map[string]scanCacheEntry `json:"entries"`
+}
+
+var (
+	sharedScanCacheOnce sync.Once
+	sharedScanCache     *scanCache
+)
+
+// openScanCache returns the cache shared by all cleaner scans, loading it from disk
+// on first use. force empties it so that everything is walked again.
+func openScanCache(force bool) *scanCache {
+	sharedScanCacheOnce.Do(func() {
+		sharedScanCache = &scanCache{entries: loadScanCacheEntries()}
+	})
+
+	if force {
+		sharedScanCache.mu.Lock()
+		sharedScanCache.entries = map[string]scanCacheEntry{}
+		sharedScanCache.dirty = true
+		sharedScanCache.mu.Unlock()
+	}
+	return sharedScanCache
+}
+
+// loadScanCacheEntries never fails: a missing or broken cache just means a full walk
+func loadScanCacheEntries() map[string]scanCacheEntry {
+	entries := map[string]scanCacheEntry{}
+
+	path, err := scanCachePath()
+	if err != nil {
+		return entries
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entries
+	}
+
+	var file scanCacheFileData
+	if json.Unmarshal(data, &file) != nil || file.Version != scanCacheVersion || file.Entries == nil {
+		return entries
+	}
+	return file.Entries
+}
+
+func scanCachePath() (string, error) {
+	dir, err := appDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, scanCacheFile), nil
+}
+
+// lookup returns the cached listing of path if the directory hasn't changed since
+func (c *scanCache) lookup(path string) (scanCacheEntry, bool) {
+	if c == nil {
+		return scanCacheEntry{}, false
+	}
+
+	c.mu.Lock()
+	entry, exists := c.entries[path]
+	c.mu.Unlock()
+	if !exists || time.Since(time.Unix(entry.Walked, 0)) > scanCacheMaxAge {
+		return scanCacheEntry{}, false
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil || !info.IsDir() || info.ModTime().UnixNano() != entry.ModTime {
+		return scanCacheEntry{}, false
+	}
+	if id, ok := identityOf(path, info); !ok || id.Inode != entry.Inode {
+		return scanCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// store records the listing of path. info must be from before the directory was read,
+// so that changes made while reading it show up as a different mtime next time.
+func (c *scanCache) store(path string, info os.FileInfo, entry scanCacheEntry) {
+	if c == nil || time.Since(info.ModTime()) < scanCacheRacyWindow {
+		return
+	}
+	id, ok := identityOf(path, info)
+	if !ok {
+		return
+	}
+
+	entry.Inode = id.Inode
+	entry.ModTime = info.ModTime().UnixNano()
+	entry.Walked = time.Now().Unix()
+
+	c.mu.Lock()
+	c.entries[path] = entry
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// save writes the cache to disk if it changed, leaving out expired entries
+func (c *scanCache) save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	for path, entry := range c.entries {
+		if time.Since(time.Unix(entry.Walked, 0)) > scanCacheMaxAge {
+			delete(c.entries, path)
+		}
+	}
+
+	path, err := scanCachePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(scanCacheFileData{Version: scanCacheVersion, Entries: c.entries})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
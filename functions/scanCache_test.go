@@ -0,0 +1,65 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanCacheReusesUnchangedDirectories(t *testing.T) {
+	useTempAppData(t)
+
+	root := t.TempDir()
+	write := func(rel string, size int) {
+		writeTestFile(t, filepath.Join(root, filepath.FromSlash(rel)), make([]byte, size))
+	}
+	write("a/one", 100)
+	write("a/deep/two", 200)
+	write("b/three", 300)
+
+	old := time.Now().Add(-time.Hour)
+	for _, rel := range []string{".", "a", "a/deep", "b"} {
+		os.Chtimes(filepath.Join(root, rel), old, old)
+	}
+
+	cache := &scanCache{entries: map[string]scanCacheEntry{}}
+	size := func(cache *scanCache) int64 {
+		scanner := newCleanerScanner(context.Background(), nil)
+		scanner.cache = cache
+		return scanner.dirSize(root, 0, false)
+	}
+	if got := size(cache); got != 600 {
+		t.Fatalf("Expected 600 bytes, got %d", got)
+	}
+	if len(cache.entries) != 4 {
+		t.Fatalf("Expected every directory to be cached, got: %v", cache.entries)
+	}
+
+	// A removal the mtime doesn't show is invisible: the cached listing is used
+	os.Remove(filepath.Join(root, "a", "deep", "two"))
+	os.Chtimes(filepath.Join(root, "a", "deep"), old, old)
+	if got := size(cache); got != 600 {
+		t.Errorf("Expected the cached 600 bytes, got %d", got)
+	}
+
+	// A changed directory is read again, the rest still comes from the cache
+	write("b/four", 50)
+	if got := size(cache); got != 650 {
+		t.Errorf("Expected b to be rewalked for 650 bytes, got %d", got)
+	}
+
+	// A forced rescan starts from an empty cache
+	if got := size(&scanCache{entries: map[string]scanCacheEntry{}}); got != 450 {
+		t.Errorf("Expected a full walk to find 450 bytes, got %d", got)
+	}
+
+	if err := cache.save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := loadScanCacheEntries()
+	if entry, exists := loaded[filepath.Join(root, "a")]; !exists || entry.Size != 100 || len(entry.Dirs) != 1 {
+		t.Errorf("Expected the cache to be saved, got: %+v", loaded)
+	}
+}
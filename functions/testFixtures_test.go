@@ -0,0 +1,54 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTempAppData keeps the app state a test writes (audit log, quarantine, scan
+// cache) out of the real data directory
+func useTempAppData(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("LOCALAPPDATA", t.TempDir())
+}
+
+// writeTestFile writes data to path, creating its parent directories
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// backdate moves the modification time of paths an hour back, past the age guard
+// applied when open files can't be detected
+func backdate(t *testing.T, paths ...string) {
+	t.Helper()
+	old := time.Now().Add(-time.Hour)
+	for _, path := range paths {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeScannedFile writes a backdated file below root and registers it as found by
+// a cleaner scan of root, so CleanFiles accepts it
+func writeScannedFile(t *testing.T, root, name string, data []byte) FileInfo {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	writeTestFile(t, path, data)
+	backdate(t, path)
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FileInfo{Path: path, Name: name, Size: info.Size(), FileID: registerScannedFile(DirInfo{Path: root}, path, info)}
+}
@@ -0,0 +1,259 @@
+package functions
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// ThumbnailState is how a cached thumbnail relates to the file it was made from
+type ThumbnailState string
+
+const (
+	ThumbnailValid    ThumbnailState = "valid"
+	ThumbnailOrphaned ThumbnailState = "orphaned"
+	ThumbnailStale    ThumbnailState = "stale"
+)
+
+// maxThumbnailTextChunk bounds how much of a text chunk is read; URIs are short
+const maxThumbnailTextChunk = 64 << 10
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// ThumbnailFolderUsage sums up one subfolder (normal, large, ...) of the thumbnail cache
+type ThumbnailFolderUsage struct {
+	Folder        string `json:"folder"`
+	Size          int64  `json:"size"`
+	Count         int    `json:"count"`
+	OrphanedCount int    `json:"orphanedCount"`
+	StaleCount    int    `json:"staleCount"`
+	// ReclaimableSize is the size of the orphaned and stale thumbnails
+	ReclaimableSize int64 `json:"reclaimableSize"`
+}
+
+func thumbnailDirs() []string {
+	cache := rulePathVar("XDG_CACHE_HOME")
+	if cache == "" {
+		return nil
+	}
+	return []string{filepath.Join(cache, "thumbnails")}
+}
+
+// scanThumbnails offers the orphaned and stale thumbnails below dir and records the
+// usage of each subfolder. Valid thumbnails, and those whose source can't be checked,
+// are kept.
+func (s *cleanerScanner) scanThumbnails(dir DirInfo) ([]FileInfo, int64) {
+	var files []FileInfo
+	var totalSize int64
+
+	folders, err := os.ReadDir(dir.Path)
+	if err != nil {
+		return files, 0
+	}
+
+	for _, folder := range folders {
+		if !folder.IsDir() || s.ctx.Err() != nil {
+			continue
+		}
+
+		usage := ThumbnailFolderUsage{Folder: folder.Name()}
+		folderPath := filepath.Join(dir.Path, folder.Name())
+
+		// fail/ has one more level, named after the application that failed
+		filepath.WalkDir(folderPath, func(path string, d fs.DirEntry, err error) error {
+			if s.ctx.Err() != nil {
+				return s.ctx.Err()
+			}
+			if err != nil || !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			usage.Size += info.Size()
+			usage.Count++
+			s.filesCounted.Add(1)
+			s.bytesFound.Add(info.Size())
+
+			state, source := classifyThumbnail(path)
+			if state == ThumbnailValid {
+				return nil
+			}
+			if state == ThumbnailOrphaned {
+				usage.OrphanedCount++
+			} else {
+				usage.StaleCount++
+			}
+			usage.ReclaimableSize += info.Size()
+
+			rel, _ := filepath.Rel(dir.Path, path)
+			files = append(files, FileInfo{
+				Path:           path,
+				Size:           info.Size(),
+				Name:           rel + " (" + string(state) + ")",
+				Location:       dir.Location,
+				NeedsElevation: dir.NeedsElevation,
+				RuleID:         dir.RuleID,
+				FileID:         registerScannedFile(dir, path, info),
+				OriginalPath:   source,
+			})
+			totalSize += info.Size()
+			return nil
+		})
+
+		s.addThumbnailUsage(usage)
+	}
+
+	return files, totalSize
+}
+
+func (s *cleanerScanner) addThumbnailUsage(usage ThumbnailFolderUsage) {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	s.thumbnails = append(s.thumbnails, usage)
+}
+
+// thumbnailUsage returns the thumbnail folders seen so far, sorted by name
+func (s *cleanerScanner) thumbnailUsage() []ThumbnailFolderUsage {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+
+	usage := append([]ThumbnailFolderUsage{}, s.thumbnails...)
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Folder < usage[j].Folder })
+	return usage
+}
+
+// classifyThumbnail compares a thumbnail's Thumb::URI and Thumb::MTime with its source.
+// Anything that can't be checked (not a PNG, no URI, a remote URI, a source on a
+// volume that isn't mounted) counts as valid.
+func classifyThumbnail(path string) (ThumbnailState, string) {
+	text, err := readPNGText(path)
+	if err != nil {
+		return ThumbnailValid, ""
+	}
+
+	uri, err := url.Parse(text["Thumb::URI"])
+	if err != nil || uri.Scheme != "file" || uri.Path == "" {
+		return ThumbnailValid, ""
+	}
+	source := filepath.FromSlash(uri.Path)
+
+	info, err := os.Stat(source)
+	if errors.Is(err, os.ErrNotExist) {
+		// Only call it orphaned when the folder is there but the file isn't
+		if _, err := os.Stat(filepath.Dir(source)); err == nil {
+			return ThumbnailOrphaned, source
+		}
+		return ThumbnailValid, source
+	}
+	if err != nil {
+		return ThumbnailValid, source
+	}
+
+	if mtime, err := strconv.ParseInt(text["Thumb::MTime"], 10, 64); err == nil && mtime != info.ModTime().Unix() {
+		return ThumbnailStale, source
+	}
+	return ThumbnailValid, source
+}
+
+// readPNGText returns the tEXt, zTXt and iTXt key/value pairs that come before the
+// image data of a PNG
+func readPNGText(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return nil, errors.New("not a PNG file")
+	}
+
+	text := map[string]string{}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return text, nil
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		chunkType := string(header[4:])
+
+		if chunkType == "IDAT" || chunkType == "IEND" {
+			return text, nil
+		}
+		if (chunkType != "tEXt" && chunkType != "zTXt" && chunkType != "iTXt") || length > maxThumbnailTextChunk {
+			if _, err := r.Discard(int(length) + 4); err != nil {
+				return text, nil
+			}
+			continue
+		}
+
+		data := make([]byte, length+4) // chunk data and CRC
+		if _, err := io.ReadFull(r, data); err != nil {
+			return text, nil
+		}
+		if key, value, ok := parsePNGTextChunk(chunkType, data[:length]); ok {
+			text[key] = value
+		}
+	}
+}
+
+func parsePNGTextChunk(chunkType string, data []byte) (string, string, bool) {
+	key, rest, found := bytes.Cut(data, []byte{0})
+	if !found {
+		return "", "", false
+	}
+
+	switch chunkType {
+	case "tEXt":
+		return string(key), string(rest), true
+	case "zTXt":
+		// compression method, then zlib data
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		value, err := inflate(rest[1:])
+		return string(key), value, err == nil
+	case "iTXt":
+		// compression flag, compression method, language tag, translated keyword, text
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed := rest[0] == 1
+		_, rest, _ = bytes.Cut(rest[2:], []byte{0})
+		_, rest, found = bytes.Cut(rest, []byte{0})
+		if !found {
+			return "", "", false
+		}
+		if !compressed {
+			return string(key), string(rest), true
+		}
+		value, err := inflate(rest)
+		return string(key), value, err == nil
+	}
+	return "", "", false
+}
+
+func inflate(data []byte) (string, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	value, err := io.ReadAll(io.LimitReader(r, maxThumbnailTextChunk))
+	return string(value), err
+}
@@ -0,0 +1,79 @@
+package functions
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeThumbnail writes a 1x1 PNG with the given text chunks right after IHDR
+func writeThumbnail(t *testing.T, path string, text map[string]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	// Signature (8 bytes) and IHDR (4 + 4 + 13 + 4 bytes)
+	headerEnd := 8 + 25
+	var out bytes.Buffer
+	out.Write(encoded[:headerEnd])
+	for key, value := range text {
+		data := append([]byte(key+"\x00"), value...)
+		chunk := append([]byte("tEXt"), data...)
+		binary.Write(&out, binary.BigEndian, uint32(len(data)))
+		out.Write(chunk)
+		binary.Write(&out, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	}
+	out.Write(encoded[headerEnd:])
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, out.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClassifyThumbnail(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(source, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(source, mtime, mtime)
+
+	thumbs := filepath.Join(dir, "thumbnails", "normal")
+	cases := map[string]struct {
+		text map[string]string
+		want ThumbnailState
+	}{
+		"valid.png":     {map[string]string{"Thumb::URI": "file://" + source, "Thumb::MTime": strconv.FormatInt(mtime.Unix(), 10)}, ThumbnailValid},
+		"stale.png":     {map[string]string{"Thumb::URI": "file://" + source, "Thumb::MTime": "12345"}, ThumbnailStale},
+		"orphaned.png":  {map[string]string{"Thumb::URI": "file://" + filepath.Join(dir, "gone%20away.jpg")}, ThumbnailOrphaned},
+		"unmounted.png": {map[string]string{"Thumb::URI": "file:///media/not-mounted/photo.jpg"}, ThumbnailValid},
+		"remote.png":    {map[string]string{"Thumb::URI": "https://example.com/photo.jpg"}, ThumbnailValid},
+	}
+
+	for name, c := range cases {
+		path := filepath.Join(thumbs, name)
+		writeThumbnail(t, path, c.text)
+		if got, _ := classifyThumbnail(path); got != c.want {
+			t.Errorf("classifyThumbnail(%s) = %s, want %s", name, got, c.want)
+		}
+	}
+
+	if _, source := classifyThumbnail(filepath.Join(thumbs, "orphaned.png")); source != filepath.Join(dir, "gone away.jpg") {
+		t.Errorf("Expected the unescaped source path, got: %s", source)
+	}
+}
@@ -0,0 +1,265 @@
+package functions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/disk"
+)
+
+// trashInfoDateFormat is the DeletionDate format from the freedesktop.org Trash spec
+const trashInfoDateFormat = "2006-01-02T15:04:05"
+
+// moveToTrash moves path into the freedesktop.org Trash: the home trash when path is
+// on the same filesystem as it, otherwise the trash at the top of path's mount
+func moveToTrash(path string) error {
+	if runtime.GOOS != "linux" {
+		return errors.New("moving to Trash is only supported on Linux")
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	device, deviceKnown := deviceOf(info)
+
+	homeTrash := homeTrashDir()
+	if homeTrash == "" {
+		return errors.New("no home directory for the Trash")
+	}
+	if err := os.MkdirAll(filepath.Dir(homeTrash), 0700); err != nil {
+		return err
+	}
+
+	topdir := ""
+	if homeInfo, err := os.Stat(filepath.Dir(homeTrash)); err == nil && !sameDevice(homeInfo, device, deviceKnown) {
+		topdir = mountTopdir(path, device)
+	}
+	return trashPath(path, homeTrash, topdir)
+}
+
+// trashPath moves path into the trash of topdir, the mount it is on, or into the home
+// trash when topdir is empty. If the mount has no usable trash the home trash is used
+// anyway, which means copying across devices.
+func trashPath(path, homeTrash, topdir string) error {
+	if topdir != "" {
+		if trashDir, err := topdirTrashDir(topdir); err == nil {
+			if rel, err := filepath.Rel(topdir, path); err == nil {
+				if err := trashInto(trashDir, path, rel); err == nil {
+					return nil
+				}
+			}
+		}
+	}
+
+	return trashInto(homeTrash, path, path)
+}
+
+// trashInto writes the .trashinfo first, as the spec requires, then moves the file in.
+// recordedPath is absolute for the home trash and relative to the topdir otherwise.
+func trashInto(trashDir, path, recordedPath string) error {
+	filesDir := filepath.Join(trashDir, "files")
+	infoDir := filepath.Join(trashDir, "info")
+	if err := os.MkdirAll(filesDir, 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(infoDir, 0700); err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		escapeTrashPath(recordedPath), time.Now().Format(trashInfoDateFormat))
+
+	base := filepath.Base(path)
+	for i := 1; i < 1000; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d", base, i)
+		}
+
+		// O_EXCL on the info file is how the spec reserves a name
+		infoPath := filepath.Join(infoDir, name+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = f.WriteString(content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = moveFile(path, filepath.Join(filesDir, name))
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			return err
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no free name in %s for %s", trashDir, base)
+}
+
+func homeTrashDir() string {
+	dataHome := rulePathVar("XDG_DATA_HOME")
+	if dataHome == "" {
+		return ""
+	}
+	return filepath.Join(dataHome, "Trash")
+}
+
+// topdirTrashDir returns $topdir/.Trash/$uid when the admin has set up a safe shared
+// .Trash (sticky, not a symlink), otherwise $topdir/.Trash-$uid, creating it if needed
+func topdirTrashDir(topdir string) (string, error) {
+	if shared, ok := sharedTrashDir(topdir); ok {
+		if err := os.MkdirAll(shared, 0700); err == nil {
+			return shared, nil
+		}
+	}
+
+	dir := filepath.Join(topdir, ".Trash-"+strconv.Itoa(os.Getuid()))
+	if err := os.Mkdir(dir, 0700); err != nil && !errors.Is(err, os.ErrExist) {
+		return "", err
+	}
+	if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("unusable trash directory: %s", dir)
+	}
+	return dir, nil
+}
+
+// sharedTrashDir returns $topdir/.Trash/$uid if $topdir/.Trash may be used
+func sharedTrashDir(topdir string) (string, bool) {
+	shared := filepath.Join(topdir, ".Trash")
+	info, err := os.Lstat(shared)
+	if err != nil || !info.IsDir() || info.Mode()&os.ModeSticky == 0 {
+		return "", false
+	}
+	return filepath.Join(shared, strconv.Itoa(os.Getuid())), true
+}
+
+// topdirTrashDirs returns the current user's trash directories on the mount at topdir
+// that exist. Both can: the shared one may have been set up after the other was used.
+func topdirTrashDirs(topdir string) []string {
+	var dirs []string
+	candidates := []string{filepath.Join(topdir, ".Trash-"+strconv.Itoa(os.Getuid()))}
+	if shared, ok := sharedTrashDir(topdir); ok {
+		candidates = append([]string{shared}, candidates...)
+	}
+	for _, dir := range candidates {
+		if info, err := os.Lstat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// mountTopdir walks up from path to the top directory of its filesystem
+func mountTopdir(path string, device uint64) string {
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		info, err := os.Lstat(parent)
+		if err != nil || !sameDevice(info, device, true) {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// escapeTrashPath percent-encodes a path for the Path key, keeping the slashes
+func escapeTrashPath(path string) string {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// trashDirs is the rule provider for the Trash category: the home trash and the
+// current user's trash on every mounted filesystem
+func trashDirs() []string {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+
+	var dirs []string
+	if home := homeTrashDir(); home != "" {
+		dirs = append(dirs, filepath.Join(home, "files"))
+	}
+
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return dirs
+	}
+	for _, partition := range partitions {
+		if partition.Mountpoint == "/" {
+			continue
+		}
+		for _, trashDir := range topdirTrashDirs(partition.Mountpoint) {
+			dirs = append(dirs, filepath.Join(trashDir, "files"))
+		}
+	}
+	return dirs
+}
+
+// trashInfoPath returns the .trashinfo file that belongs to an entry of a files/ dir
+func trashInfoPath(entryPath string) string {
+	trashDir := filepath.Dir(filepath.Dir(entryPath))
+	return filepath.Join(trashDir, "info", filepath.Base(entryPath)+".trashinfo")
+}
+
+// describeTrashEntry fills in where a trashed entry came from and when it was trashed
+func describeTrashEntry(file *FileInfo) {
+	f, err := os.Open(trashInfoPath(file.Path))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var originalPath, deletionDate string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Path":
+			originalPath = value
+		case "DeletionDate":
+			deletionDate = value
+		}
+	}
+
+	if unescaped, err := url.PathUnescape(originalPath); err == nil {
+		originalPath = unescaped
+	}
+	// Relative paths in a topdir trash are relative to the mount it sits on
+	if originalPath != "" && !filepath.IsAbs(originalPath) {
+		topdir := filepath.Dir(filepath.Dir(filepath.Dir(file.Path)))
+		if filepath.Base(topdir) == ".Trash" {
+			topdir = filepath.Dir(topdir)
+		}
+		originalPath = filepath.Join(topdir, originalPath)
+	}
+
+	file.OriginalPath = originalPath
+	if deleted, err := time.ParseInLocation(trashInfoDateFormat, deletionDate, time.Local); err == nil {
+		file.DeletedAt = deleted
+	}
+}
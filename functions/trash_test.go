@@ -0,0 +1,177 @@
+package functions
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestTrashIntoReservesNamesWithTheInfoFile(t *testing.T) {
+	trash := filepath.Join(t.TempDir(), "Trash")
+	src := t.TempDir()
+
+	// A name taken by an info file alone is still taken
+	os.MkdirAll(filepath.Join(trash, "info"), 0700)
+	os.WriteFile(filepath.Join(trash, "info", "notes.txt.trashinfo"), nil, 0600)
+
+	path := filepath.Join(src, "notes.txt")
+	if err := os.WriteFile(path, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := trashInto(trash, path, "/home/user/my notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"files/notes.txt.2", "notes"},
+		{"info/notes.txt.2.trashinfo", "Path=/home/user/my%20notes.txt"},
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile(filepath.Join(trash, filepath.FromSlash(c.name)))
+		if err != nil || !strings.Contains(string(data), c.want) {
+			t.Errorf("%s: expected %q, got %q (%v)", c.name, c.want, data, err)
+		}
+	}
+
+	// If the move fails, the reserved name is given back
+	if err := trashInto(trash, filepath.Join(src, "missing"), "/missing"); err == nil {
+		t.Errorf("Expected trashing a missing file to fail")
+	}
+	if _, err := os.Lstat(filepath.Join(trash, "info", "missing.trashinfo")); !os.IsNotExist(err) {
+		t.Errorf("Expected the info file of a failed move to be removed, got %v", err)
+	}
+}
+
+func TestTopdirTrashSelection(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no per-mount trash on Windows")
+	}
+	uid := strconv.Itoa(os.Getuid())
+
+	cases := []struct {
+		name string
+		// setup prepares $topdir/.Trash
+		setup func(topdir string)
+		want  string
+	}{
+		{"no shared trash", func(string) {}, ".Trash-" + uid},
+		{"sticky shared trash", func(topdir string) {
+			os.Mkdir(filepath.Join(topdir, ".Trash"), 0777)
+			os.Chmod(filepath.Join(topdir, ".Trash"), 0777|os.ModeSticky)
+		}, filepath.Join(".Trash", uid)},
+		{"shared trash without sticky bit", func(topdir string) {
+			os.Mkdir(filepath.Join(topdir, ".Trash"), 0777)
+		}, ".Trash-" + uid},
+		{"shared trash is a symlink", func(topdir string) {
+			target := filepath.Join(topdir, "elsewhere")
+			os.Mkdir(target, 0777)
+			os.Chmod(target, 0777|os.ModeSticky)
+			os.Symlink(target, filepath.Join(topdir, ".Trash"))
+		}, ".Trash-" + uid},
+	}
+
+	for _, c := range cases {
+		topdir := t.TempDir()
+		c.setup(topdir)
+
+		got, err := topdirTrashDir(topdir)
+		if err != nil || got != filepath.Join(topdir, c.want) {
+			t.Errorf("%s: got %s (%v), want %s", c.name, got, err, c.want)
+		}
+		if info, err := os.Lstat(got); err != nil || !info.IsDir() {
+			t.Errorf("%s: expected %s to be created", c.name, got)
+		}
+	}
+}
+
+func TestTopdirTrashDirsListsBoth(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no per-mount trash on Windows")
+	}
+	uid := strconv.Itoa(os.Getuid())
+	topdir := t.TempDir()
+
+	if dirs := topdirTrashDirs(topdir); len(dirs) != 0 {
+		t.Errorf("Expected no trash directories yet, got %v", dirs)
+	}
+
+	// Used before the admin set up a shared .Trash, and after
+	os.Mkdir(filepath.Join(topdir, ".Trash-"+uid), 0700)
+	os.Mkdir(filepath.Join(topdir, ".Trash"), 0777)
+	os.Chmod(filepath.Join(topdir, ".Trash"), 0777|os.ModeSticky)
+	os.Mkdir(filepath.Join(topdir, ".Trash", uid), 0700)
+
+	dirs := topdirTrashDirs(topdir)
+	want := []string{filepath.Join(topdir, ".Trash", uid), filepath.Join(topdir, ".Trash-"+uid)}
+	if strings.Join(dirs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected both trash directories, got %v", dirs)
+	}
+}
+
+func TestTrashAcrossDevices(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no per-mount trash on Windows")
+	}
+
+	cases := []struct {
+		name string
+		// broken leaves the mount without a usable trash
+		broken bool
+		// crossDevice makes every rename fail like one between filesystems
+		crossDevice bool
+		wantHome    bool
+	}{
+		{"mount trash", false, false, false},
+		{"no usable mount trash", true, false, true},
+		{"copy into the home trash", true, true, true},
+	}
+
+	for _, c := range cases {
+		homeTrash := filepath.Join(t.TempDir(), "Trash")
+		topdir := t.TempDir()
+		path := filepath.Join(topdir, "data", "file.bin")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if c.broken {
+			// A file where the trash directory should be
+			os.WriteFile(filepath.Join(topdir, ".Trash-"+strconv.Itoa(os.Getuid())), nil, 0600)
+		}
+		if c.crossDevice {
+			renameFile = func(src, dst string) error {
+				return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EXDEV}
+			}
+		}
+
+		err := trashPath(path, homeTrash, topdir)
+		renameFile = os.Rename
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the file to be gone from its place", c.name)
+		}
+
+		// The home trash records absolute paths, a mount's trash relative ones
+		trashDir, recorded := filepath.Join(topdir, ".Trash-"+strconv.Itoa(os.Getuid())), "data/file.bin"
+		if c.wantHome {
+			trashDir, recorded = homeTrash, escapeTrashPath(path)
+		}
+		if data, err := os.ReadFile(filepath.Join(trashDir, "files", "file.bin")); err != nil || string(data) != "data" {
+			t.Errorf("%s: expected the file in %s, got %q (%v)", c.name, trashDir, data, err)
+		}
+		info, _ := os.ReadFile(filepath.Join(trashDir, "info", "file.bin.trashinfo"))
+		if !strings.Contains(string(info), "Path="+recorded+"\n") {
+			t.Errorf("%s: expected Path=%s, got %q", c.name, recorded, info)
+		}
+	}
+}
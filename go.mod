@@ -8,6 +8,7 @@ require (
 	github.com/distatus/battery v0.11.0
 	github.com/shirou/gopsutil/v4 v4.25.3
 	github.com/wailsapp/wails/v2 v2.9.2
+	golang.org/x/sys v0.28.0
 )
 
 require (
@@ -42,7 +43,6 @@ require (
 	golang.org/x/crypto v0.23.0 // indirect
 	golang.org/x/exp v0.0.0-20230522175609-2e198f4a06a1 // indirect
 	golang.org/x/net v0.25.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
 	howett.net/plist v1.0.0 // indirect
 )
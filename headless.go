@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"myproject/functions"
+)
+
+// runHeadless runs cleaning jobs from the command line without opening a window, so
+// they can be driven by systemd timers or cron:
+//
+//	sysinfopro --run-clean-jobs          run every job that is due
+//	sysinfopro --run-clean-job=<id>      run one job now
+//
+// It reports whether it handled the invocation and the exit code to use.
+func runHeadless(args []string) (bool, int) {
+	headless := false
+	for _, arg := range args {
+		if strings.HasPrefix(strings.TrimLeft(arg, "-"), "run-clean-job") {
+			headless = true
+		}
+	}
+	if !headless {
+		return false, 0
+	}
+
+	flags := flag.NewFlagSet("sysinfopro", flag.ContinueOnError)
+	runDue := flags.Bool("run-clean-jobs", false, "run the cleaning jobs that are due and exit")
+	runJob := flags.String("run-clean-job", "", "run the cleaning job with this id and exit")
+	if err := flags.Parse(args); err != nil {
+		return true, 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var runs []functions.CleanJobRun
+	var err error
+	switch {
+	case *runJob != "":
+		var run functions.CleanJobRun
+		run, err = functions.RunCleanJob(ctx, *runJob)
+		runs = append(runs, run)
+	case *runDue:
+		runs, err = functions.RunDueCleanJobs(ctx)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return true, 1
+	}
+
+	return true, reportCleanJobRuns(runs)
+}
+
+// notifyCleanJobRun is functions.NotifyCleanJobRun, replaceable in tests
+var notifyCleanJobRun = functions.NotifyCleanJobRun
+
+// reportCleanJobRuns prints each run and shows it as a desktop notification, since
+// there is no window to show it in. It returns 1 if a run failed.
+func reportCleanJobRuns(runs []functions.CleanJobRun) int {
+	code := 0
+	for _, run := range runs {
+		fmt.Printf("%s (%s): %s\n", run.JobName, run.Trigger, run.Describe())
+		if run.Error != "" {
+			code = 1
+		}
+		// Timers and cron may run without a desktop session to notify
+		if err := notifyCleanJobRun(run); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		}
+	}
+	return code
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"myproject/functions"
+)
+
+func TestRunHeadless(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("APPDATA", filepath.Join(home, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(home, "data"))
+
+	cases := []struct {
+		name    string
+		args    []string
+		handled bool
+		code    int
+	}{
+		{"window", nil, false, 0},
+		{"other flags", []string{"--verbose"}, false, 0},
+		{"nothing due", []string{"--run-clean-jobs"}, true, 0},
+		{"unknown job", []string{"--run-clean-job=missing"}, true, 1},
+		{"bad flag", []string{"--run-clean-jobs", "--bogus"}, true, 2},
+	}
+	for _, c := range cases {
+		if handled, code := runHeadless(c.args); handled != c.handled || code != c.code {
+			t.Errorf("%s: got (%v, %d), want (%v, %d)", c.name, handled, code, c.handled, c.code)
+		}
+	}
+}
+
+func TestReportCleanJobRuns(t *testing.T) {
+	var notified []string
+	notifyCleanJobRun = func(run functions.CleanJobRun) error {
+		notified = append(notified, run.JobID)
+		if run.Error != "" {
+			return errors.New("no desktop session")
+		}
+		return nil
+	}
+	defer func() { notifyCleanJobRun = functions.NotifyCleanJobRun }()
+
+	runs := []functions.CleanJobRun{
+		{JobID: "ok", JobName: "Caches", Trigger: "schedule"},
+		{JobID: "failed", JobName: "Logs", Trigger: "schedule", Error: "scan failed"},
+	}
+	if code := reportCleanJobRuns(runs); code != 1 {
+		t.Errorf("Expected a failed run to exit with 1, got %d", code)
+	}
+	if len(notified) != 2 || notified[0] != "ok" || notified[1] != "failed" {
+		t.Errorf("Expected every run to be notified, even when a notification fails, got %v", notified)
+	}
+
+	if code := reportCleanJobRuns(runs[:1]); code != 0 {
+		t.Errorf("Expected a successful run to exit with 0, got %d", code)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -13,6 +14,11 @@ import (
 var assets embed.FS
 
 func main() {
+	// Cleaning jobs can run without the window, e.g. from a systemd timer
+	if handled, code := runHeadless(os.Args[1:]); handled {
+		os.Exit(code)
+	}
+
 	// Create an instance of the app structure
 	app := NewApp()
 